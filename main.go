@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -16,6 +17,11 @@ func main() {
 
 	if err := root.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
+
+		if errors.Is(err, cmd.ErrDriftDetected) {
+			os.Exit(2) //nolint:mnd
+		}
+
 		os.Exit(1)
 	}
 }
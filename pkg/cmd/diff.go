@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/Mirantis/ktl/pkg/runner"
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+)
+
+const defaultDiffWidth = 160
+
+var errUnsupportedGroupBy = errors.New("unsupported group-by")
+
+type diffOptions struct {
+	fileName   string
+	clusters   []string
+	groupBy    string
+	sideBySide bool
+	width      int
+}
+
+// writeDiff compares the first variant of every resource with the others.
+func writeDiff(writer io.Writer, resources *types.ClusterResources, opts *diffOptions) error {
+	ids := slices.SortedFunc(maps.Keys(resources.Resources), func(a, b resid.ResId) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	for _, id := range ids {
+		variants := output.ClusterVariants(resources, id, opts.groupBy == "tag")
+		for i := range variants {
+			variants[i].Name += " " + id.String()
+		}
+
+		for _, variant := range variants[1:] {
+			diff := output.UnifiedDiff(variants[0], variant)
+			if diff != "" && opts.sideBySide {
+				diff = output.SideBySideDiff(variants[0], variant, opts.width)
+			}
+
+			if _, err := io.WriteString(writer, diff); err != nil {
+				return err //nolint:wrapcheck
+			}
+		}
+	}
+
+	return nil
+}
+
+func newDiffCommand() *cobra.Command {
+	opts := &diffOptions{
+		fileName: runner.DefaultFileName,
+		groupBy:  "cluster",
+		width:    defaultDiffWidth,
+	}
+	diff := &cobra.Command{
+		Use:   "diff KIND NAME",
+		Short: "compare a resource across the clusters",
+		Args:  cobra.ExactArgs(2), //nolint:mnd
+		RunE: func(cmd *cobra.Command, args []string) error { //nolint:revive
+			if opts.groupBy != "cluster" && opts.groupBy != "tag" {
+				return fmt.Errorf("%w: %s", errUnsupportedGroupBy, opts.groupBy)
+			}
+
+			env, pipeline, err := loadPipeline(opts.fileName)
+			if err != nil {
+				return err
+			}
+
+			clusterDiff := &runner.ClusterDiff{
+				Pipeline: pipeline,
+				Clusters: opts.clusters,
+				Kind:     args[0],
+				Name:     args[1],
+				KeepTags: opts.groupBy == "tag",
+			}
+
+			resources, err := clusterDiff.Run(env)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			return writeDiff(cmd.OutOrStdout(), resources, opts)
+		},
+	}
+
+	flags := diff.Flags()
+	flags.StringVarP(&opts.fileName, "filename", "f", opts.fileName, "pipeline config")
+	flags.StringSliceVar(&opts.clusters, "clusters", nil, "compared clusters, all by default")
+	flags.StringVar(&opts.groupBy, "group-by", opts.groupBy, "compare the clusters or the variants of the tagged cluster groups: cluster or tag")
+	flags.BoolVarP(&opts.sideBySide, "side-by-side", "y", false, "print the diff in two columns")
+	flags.IntVarP(&opts.width, "width", "W", opts.width, "side-by-side diff width")
+
+	return diff
+}
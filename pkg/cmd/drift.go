@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Mirantis/ktl/pkg/fsutil"
+	"github.com/Mirantis/ktl/pkg/kubectl"
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/Mirantis/ktl/pkg/runner"
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+var (
+	// ErrDriftDetected is returned when the live clusters differ from the
+	// desired state.
+	ErrDriftDetected = errors.New("drift detected")
+
+	errUnsupportedFormat = errors.New("unsupported format")
+)
+
+func writeDriftReport(writer io.Writer, report *output.DriftReport, format string) error {
+	var (
+		body []byte
+		err  error
+	)
+
+	switch format {
+	case "text":
+		body = []byte(report.String())
+	case "yaml":
+		body, err = yaml.Marshal(report)
+	case "json":
+		body, err = json.MarshalIndent(report, "", "  ")
+		body = append(body, '\n')
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedFormat, format)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to encode the report: %w", err)
+	}
+
+	_, err = writer.Write(body)
+
+	return err //nolint:wrapcheck
+}
+
+func newDriftCommand() *cobra.Command {
+	format := "text"
+	drift := &cobra.Command{
+		Use:   "drift FILENAME",
+		Short: "compare the live clusters with the desired state",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error { //nolint:revive
+			fileName := args[0]
+			workDir := filepath.Dir(fileName)
+			env := &types.Env{
+				WorkDir: workDir,
+				FileSys: fsutil.Sub(filesys.MakeFsOnDisk(), workDir),
+				Cmd:     kubectl.New(),
+			}
+
+			driftBytes, err := os.ReadFile(fileName)
+			if err != nil {
+				return fmt.Errorf("unable to read %s: %w", fileName, err)
+			}
+
+			cfg := &runner.Drift{}
+			if err := yaml.Unmarshal(driftBytes, cfg); err != nil {
+				return fmt.Errorf("unable to parse %s: %w", fileName, err)
+			}
+
+			report, err := cfg.Run(env)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			if err := writeDriftReport(cmd.OutOrStdout(), report, format); err != nil {
+				return err
+			}
+
+			if !report.Empty() {
+				cmd.SilenceUsage = true
+
+				return ErrDriftDetected
+			}
+
+			return nil
+		},
+	}
+	drift.Flags().StringVarP(&format, "output", "o", format, "report format: text, yaml or json")
+
+	return drift
+}
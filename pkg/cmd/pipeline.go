@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Mirantis/ktl/pkg/fsutil"
+	"github.com/Mirantis/ktl/pkg/kubectl"
+	"github.com/Mirantis/ktl/pkg/runner"
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// loadPipeline parses the pipeline config, the environment is rooted in its
+// directory.
+func loadPipeline(fileName string) (*types.Env, *runner.Pipeline, error) {
+	workDir := filepath.Dir(fileName)
+	env := &types.Env{
+		WorkDir: workDir,
+		FileSys: fsutil.Sub(filesys.MakeFsOnDisk(), workDir),
+		Cmd:     kubectl.New(),
+	}
+
+	pipelineBytes, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read %s: %w", fileName, err)
+	}
+
+	pipeline := &runner.Pipeline{}
+	if err := yaml.Unmarshal(pipelineBytes, pipeline); err != nil {
+		return nil, nil, fmt.Errorf("unable to parse %s: %w", fileName, err)
+	}
+
+	return env, pipeline, nil
+}
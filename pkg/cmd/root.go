@@ -8,6 +8,9 @@ func NewRootCommand() *cobra.Command {
 	}
 	root.AddCommand(newRunCommand())
 	root.AddCommand(newMCPCommand())
+	root.AddCommand(newDriftCommand())
+	root.AddCommand(newDiffCommand())
+	root.AddCommand(newSuggestTagsCommand())
 
 	return root
 }
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Mirantis/ktl/pkg/runner"
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const defaultMaxTags = 8
+
+func newSuggestTagsCommand() *cobra.Command {
+	fileName := runner.DefaultFileName
+	maxTags := defaultMaxTags
+	suggest := &cobra.Command{
+		Use:   "suggest-tags",
+		Short: "suggest the cluster tags grouping similar clusters",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			env, pipeline, err := loadPipeline(fileName)
+			if err != nil {
+				return err
+			}
+
+			suggestion := &runner.TagSuggestion{Pipeline: pipeline, MaxTags: maxTags}
+
+			selectors, err := suggestion.Run(env)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			body, err := yaml.Marshal(struct {
+				Clusters []types.ClusterSelector `yaml:"clusters"`
+			}{selectors})
+			if err != nil {
+				return fmt.Errorf("unable to encode the cluster selectors: %w", err)
+			}
+
+			_, err = io.WriteString(cmd.OutOrStdout(), string(body))
+
+			return err //nolint:wrapcheck
+		},
+	}
+
+	flags := suggest.Flags()
+	flags.StringVarP(&fileName, "filename", "f", fileName, "pipeline config")
+	flags.IntVar(&maxTags, "max-tags", maxTags, "maximum number of the suggested tags")
+
+	return suggest
+}
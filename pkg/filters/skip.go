@@ -12,6 +12,11 @@ import (
 
 const skipAnnotation = "x-ktl-skip"
 
+// noopFilter keeps the resources of the clusters not targeted by the filters.
+var noopFilter = kio.FilterFunc(func(input []*yaml.RNode) ([]*yaml.RNode, error) { //nolint:gochecknoglobals
+	return input, nil
+})
+
 //nolint:gochecknoinits
 func init() {
 	filters.Filters["SkipFilter"] = func() kio.Filter { return &SkipFilter{} }
@@ -22,6 +27,17 @@ type SkipFilter struct {
 	Resources []*types.Selector `yaml:"resources"`
 	Except    []*types.Selector `yaml:"except"`
 	Fields    []resource.Query  `yaml:"fields"`
+	// Clusters is a label selector expression, the filter is applied only to
+	// the resources of the matching clusters.
+	Clusters types.LabelSelector `yaml:"clusters"`
+}
+
+func (filter *SkipFilter) ForCluster(clusters *types.ClusterIndex, id types.ClusterID) kio.Filter {
+	if filter.Clusters.Matches(clusters.Cluster(id)) {
+		return filter
+	}
+
+	return noopFilter
 }
 
 func (filter *SkipFilter) Filter(input []*yaml.RNode) ([]*yaml.RNode, error) {
@@ -1,19 +1,32 @@
 package filters
 
 import (
+	"errors"
 	"fmt"
 	"iter"
 	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/Mirantis/ktl/pkg/resource"
+	"github.com/Mirantis/ktl/pkg/types"
 	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
 	"go.starlark.net/syntax"
 	"sigs.k8s.io/kustomize/kyaml/kio"
 	"sigs.k8s.io/kustomize/kyaml/kio/filters"
+	"sigs.k8s.io/kustomize/kyaml/resid"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
+var (
+	errUnsupportedValue = errors.New("unsupported value")
+	errUnsupportedSet   = errors.New("unsupported assignment")
+	errNotFound         = errors.New("element not found")
+)
+
 //nolint:gochecknoinits
 func init() {
 	filters.Filters["Starlark"] = func() kio.Filter { return &StarlarkFilter{} }
@@ -22,24 +35,134 @@ func init() {
 type StarlarkFilter struct {
 	Kind   string `yaml:"kind"`
 	Script string `yaml:"script"`
+	// Fleet runs the script once for all clusters, the resources are keyed
+	// by their IDs and the cluster names.
+	Fleet bool `yaml:"fleet"`
+
+	clusters *types.ClusterIndex
+	cluster  starlark.Value
+}
+
+const (
+	resourcesKey = "resources"
+	outputKey    = "output"
+	clusterKey   = "cluster"
+	clustersKey  = "clusters"
+	deleteKey    = "delete"
+)
+
+func (filter *StarlarkFilter) ForCluster(clusters *types.ClusterIndex, id types.ClusterID) kio.Filter {
+	if filter.Fleet {
+		return noopFilter
+	}
+
+	clusterFilter := *filter
+	clusterFilter.clusters = clusters
+	clusterFilter.cluster = slCluster(clusters.Cluster(id))
+
+	return &clusterFilter
 }
 
 func (filter *StarlarkFilter) Filter(input []*yaml.RNode) ([]*yaml.RNode, error) {
-	const (
-		resourcesKey = "resources"
-		outputKey    = "output"
-	)
 	snodes := []starlark.Value{}
 	output := []*yaml.RNode{}
 
 	for _, rnode := range input {
-		snodes = append(snodes, newSNode(rnode))
+		snodes = append(snodes, newResourceSNode(rnode))
+	}
+
+	slPredeclared := filter.predeclared(starlark.NewList(snodes))
+	err := filter.exec(slPredeclared)
+
+	slOutput, ok := slPredeclared[outputKey].(starlark.Iterable)
+	if !ok {
+		return nil, fmt.Errorf("starlark filter returned unsupported %q", outputKey)
+	}
+
+	for slItem := range slListAll(slOutput) {
+		rnode, err := slToRNode(slItem)
+		if err != nil {
+			return nil, err
+		}
+
+		output = append(output, rnode)
+	}
+
+	return output, err
+}
+
+func (filter *StarlarkFilter) FleetMode() bool {
+	return filter.Fleet
+}
+
+// FilterFleet runs the script of the fleet mode with the resources keyed by
+// their IDs and the cluster names, the resources left in the dict are kept.
+// The keys are inserted in the sorted order.
+func (filter *StarlarkFilter) FilterFleet(resources *types.ClusterResources) error {
+	if !filter.Fleet {
+		return nil
 	}
 
+	fleetFilter := *filter
+	fleetFilter.clusters = resources.Clusters
+	slResources := starlark.NewDict(len(resources.Resources))
+
+	for _, resID := range resources.IDs() {
+		byCluster := resources.Resources[resID]
+		slByCluster := starlark.NewDict(len(byCluster))
+		clusterIDs := slices.SortedFunc(maps.Keys(byCluster), func(a, b types.ClusterID) int {
+			return strings.Compare(resources.Clusters.Cluster(a).Name, resources.Clusters.Cluster(b).Name)
+		})
+
+		for _, clusterID := range clusterIDs {
+			rnode := byCluster[clusterID]
+			name := starlark.String(resources.Clusters.Cluster(clusterID).Name)
+			if err := slByCluster.SetKey(name, newResourceSNode(rnode)); err != nil {
+				return fmt.Errorf("starlark filter input error: %w", err)
+			}
+		}
+
+		if err := slResources.SetKey(starlark.String(resID.String()), slByCluster); err != nil {
+			return fmt.Errorf("starlark filter input error: %w", err)
+		}
+	}
+
+	slPredeclared := fleetFilter.predeclared(slResources)
+	if err := fleetFilter.exec(slPredeclared); err != nil {
+		return err
+	}
+
+	filtered, err := slFleetResources(resources.Clusters, slResources)
+	if err != nil {
+		return err
+	}
+
+	resources.Resources = filtered
+
+	return nil
+}
+
+func (filter *StarlarkFilter) predeclared(resources starlark.Value) starlark.StringDict {
 	slPredeclared := starlark.StringDict{
-		resourcesKey: starlark.NewList(snodes),
+		resourcesKey: resources,
 		outputKey:    starlark.NewList(nil),
+		clusterKey:   starlark.None,
+		clustersKey:  starlark.NewDict(0),
+		deleteKey:    starlark.NewBuiltin(deleteKey, slDelete),
+	}
+
+	if filter.cluster != nil {
+		slPredeclared[clusterKey] = filter.cluster
+	}
+
+	if filter.clusters != nil {
+		slPredeclared[clustersKey] = slClusters(filter.clusters)
 	}
+
+	return slPredeclared
+}
+
+func (filter *StarlarkFilter) exec(slPredeclared starlark.StringDict) error {
 	slOpts := &syntax.FileOptions{
 		TopLevelControl: true,
 	}
@@ -58,30 +181,203 @@ func (filter *StarlarkFilter) Filter(input []*yaml.RNode) ([]*yaml.RNode, error)
 		slPredeclared,
 	)
 
-	slOutput, ok := slPredeclared[outputKey].(starlark.Iterable)
-	if !ok {
-		return nil, fmt.Errorf("starlark filter returned unsupported %q", outputKey)
+	return err //nolint:wrapcheck
+}
+
+// slCluster returns the cluster name, tags and labels.
+func slCluster(cluster types.Cluster) starlark.Value {
+	tags := []starlark.Value{}
+	for _, tag := range cluster.Tags {
+		tags = append(tags, starlark.String(tag))
 	}
 
-	for slItem := range slListAll(slOutput) {
-		switch item := slItem.(type) {
-		case *sNodeMapping:
-			output = append(output, item.RNode)
-		case *sNodeSequence:
-			output = append(output, item.RNode)
-		case *sNode:
-			output = append(output, item.RNode)
-		default:
-			parsed, err := yaml.Parse(item.String())
+	labels := starlark.NewDict(len(cluster.Tags))
+	for key, value := range cluster.Labels() {
+		_ = labels.SetKey(starlark.String(key), starlark.String(value))
+	}
+
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"name":   starlark.String(cluster.Name),
+		"tags":   starlark.NewList(tags),
+		"labels": labels,
+	})
+}
+
+// slClusters returns the clusters keyed by their names.
+func slClusters(clusters *types.ClusterIndex) starlark.Value {
+	slClusters := starlark.NewDict(len(clusters.IDs()))
+	for _, cluster := range clusters.All() {
+		_ = slClusters.SetKey(starlark.String(cluster.Name), slCluster(cluster))
+	}
+
+	return slClusters
+}
+
+// slFleetResources returns the resources of the fleet mode dict.
+func slFleetResources(clusters *types.ClusterIndex, slResources *starlark.Dict) (map[resid.ResId]map[types.ClusterID]*yaml.RNode, error) {
+	resources := map[resid.ResId]map[types.ClusterID]*yaml.RNode{}
+
+	for _, item := range slResources.Items() {
+		slByCluster, ok := item[1].(starlark.IterableMapping)
+		if !ok {
+			return nil, fmt.Errorf("starlark filter returned unsupported %s: %s", resourcesKey, item[0])
+		}
+
+		for _, clusterItem := range slByCluster.Items() {
+			name, _ := starlark.AsString(clusterItem[0])
+
+			clusterID, err := clusters.ID(name)
 			if err != nil {
-				return nil, fmt.Errorf("starlark result parsing error: %w", err)
+				return nil, fmt.Errorf("starlark filter returned unsupported %s: %w", resourcesKey, err)
 			}
-			parsed.YNode().Style = 0
-			output = append(output, parsed)
+
+			rnode, err := slToRNode(clusterItem[1])
+			if err != nil {
+				return nil, err
+			}
+
+			resID := resid.FromRNode(rnode)
+			if resources[resID] == nil {
+				resources[resID] = map[types.ClusterID]*yaml.RNode{}
+			}
+
+			resources[resID][clusterID] = rnode
 		}
 	}
 
-	return output, err
+	return resources, nil
+}
+
+func slToRNode(value starlark.Value) (*yaml.RNode, error) {
+	switch item := value.(type) {
+	case *sNodeMapping:
+		return item.RNode, nil
+	case *sNodeSequence:
+		return item.RNode, nil
+	case *sNode:
+		return item.RNode, nil
+	default:
+		ynode, err := slToYNode(item)
+		if err != nil {
+			return nil, fmt.Errorf("starlark result parsing error: %w", err)
+		}
+
+		return yaml.NewRNode(ynode), nil
+	}
+}
+
+// slToYNode converts the value to a typed YAML node, the nodes are copied.
+//
+//nolint:cyclop
+func slToYNode(value starlark.Value) (*yaml.Node, error) {
+	scalar := func(tag, text string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: text}
+	}
+
+	switch item := value.(type) {
+	case *sNodeMapping:
+		return item.Copy().YNode(), nil
+	case *sNodeSequence:
+		return item.Copy().YNode(), nil
+	case *sNode:
+		return item.Copy().YNode(), nil
+	case starlark.NoneType:
+		return scalar(yaml.NodeTagNull, "null"), nil
+	case starlark.Bool:
+		return scalar(yaml.NodeTagBool, strconv.FormatBool(bool(item))), nil
+	case starlark.Int:
+		return scalar(yaml.NodeTagInt, item.String()), nil
+	case starlark.Float:
+		return scalar(yaml.NodeTagFloat, strconv.FormatFloat(float64(item), 'g', -1, 64)), nil
+	case starlark.String:
+		return scalar(yaml.NodeTagString, string(item)), nil
+	case starlark.IterableMapping:
+		mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: yaml.NodeTagMap}
+
+		for _, kv := range item.Items() {
+			key, ok := starlark.AsString(kv[0])
+			if !ok {
+				return nil, fmt.Errorf("%w: %s key", errUnsupportedValue, kv[0].Type())
+			}
+
+			value, err := slToYNode(kv[1])
+			if err != nil {
+				return nil, err
+			}
+
+			mapping.Content = append(mapping.Content, scalar(yaml.NodeTagString, key), value)
+		}
+
+		return mapping, nil
+	case starlark.Iterable:
+		sequence := &yaml.Node{Kind: yaml.SequenceNode, Tag: yaml.NodeTagSeq}
+
+		for element := range slListAll(item) {
+			value, err := slToYNode(element)
+			if err != nil {
+				return nil, err
+			}
+
+			sequence.Content = append(sequence.Content, value)
+		}
+
+		return sequence, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedValue, value.Type())
+	}
+}
+
+func isNull(ynode *yaml.Node) bool {
+	return ynode.Kind == yaml.ScalarNode && ynode.Tag == yaml.NodeTagNull
+}
+
+// setField sets the field of the mapping, the null value removes it.
+func setField(mapping *yaml.RNode, name string, value *yaml.Node) error {
+	if isNull(value) {
+		return mapping.PipeE(yaml.Clear(name)) //nolint:wrapcheck
+	}
+
+	if mapping.YNode().Kind != yaml.MappingNode {
+		return fmt.Errorf("%w: %s of %s", errUnsupportedSet, name, mapping.YNode().Tag)
+	}
+
+	content := mapping.YNode().Content
+	for idx := 0; idx < len(content); idx += 2 {
+		if content[idx].Value == name {
+			content[idx+1] = value
+
+			return nil
+		}
+	}
+
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: yaml.NodeTagString, Value: name}
+	mapping.YNode().Content = append(content, key, value)
+
+	return nil
+}
+
+// slDelete is the delete(node, path) builtin, it removes the fields matching
+// the query path.
+func slDelete(_ *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		target starlark.Value
+		key    starlark.String
+	)
+
+	if err := starlark.UnpackPositionalArgs(builtin.Name(), args, kwargs, 2, &target, &key); err != nil { //nolint:mnd
+		return nil, err //nolint:wrapcheck
+	}
+
+	mapping, ok := target.(*sNodeMapping)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: %s", builtin.Name(), errUnsupportedValue, target.Type())
+	}
+
+	if err := mapping.clear(key); err != nil {
+		return nil, fmt.Errorf("%s: %w", builtin.Name(), err)
+	}
+
+	return starlark.None, nil
 }
 
 func slListAll(input starlark.Iterable) iter.Seq[starlark.Value] {
@@ -102,18 +398,30 @@ var (
 	_ starlark.Value           = (*sNode)(nil)
 	_ starlark.Indexable       = (*sNodeSequence)(nil)
 	_ starlark.Iterable        = (*sNodeSequence)(nil)
+	_ starlark.HasSetIndex     = (*sNodeSequence)(nil)
+	_ starlark.HasAttrs        = (*sNodeSequence)(nil)
 	_ starlark.IterableMapping = (*sNodeMapping)(nil)
 	_ starlark.HasSetKey       = (*sNodeMapping)(nil)
 	_ starlark.HasAttrs        = (*sNodeMapping)(nil)
 	_ starlark.HasSetField     = (*sNodeMapping)(nil)
 )
 
+// newResourceSNode returns the resource subscripted by the query paths.
+func newResourceSNode(rnode *yaml.RNode) starlark.Value {
+	value := newSNode(rnode)
+	if mapping, ok := value.(*sNodeMapping); ok {
+		mapping.paths = true
+	}
+
+	return value
+}
+
 func newSNode(rnode *yaml.RNode) starlark.Value {
 	sNode := &sNode{rnode}
 
 	switch rnode.YNode().Kind {
 	case yaml.MappingNode:
-		return &sNodeMapping{sNode}
+		return &sNodeMapping{sNode: sNode}
 	case yaml.SequenceNode:
 		return &sNodeSequence{sNode}
 	default:
@@ -180,8 +488,115 @@ func (node *sNodeSequence) Iterate() starlark.Iterator {
 	return starlark.NewList(items).Iterate()
 }
 
+func (node *sNodeSequence) SetIndex(idx int, value starlark.Value) error {
+	ynode, err := slToYNode(value)
+	if err != nil {
+		return err
+	}
+
+	node.Content()[idx] = ynode
+
+	return nil
+}
+
+// sequenceMethods are the list methods modifying the sequence.
+var sequenceMethods = map[string]func(node *sNodeSequence, value starlark.Value) error{ //nolint:gochecknoglobals
+	"append": (*sNodeSequence).append,
+	"extend": (*sNodeSequence).extend,
+	"remove": (*sNodeSequence).remove,
+}
+
+func (node *sNodeSequence) AttrNames() []string {
+	return slices.Sorted(maps.Keys(sequenceMethods))
+}
+
+func (node *sNodeSequence) Attr(name string) (starlark.Value, error) {
+	method, found := sequenceMethods[name]
+	if !found {
+		return nil, nil //nolint:nilnil
+	}
+
+	return starlark.NewBuiltin(name, func(_ *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var value starlark.Value
+		if err := starlark.UnpackPositionalArgs(builtin.Name(), args, kwargs, 1, &value); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		if err := method(node, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", builtin.Name(), err)
+		}
+
+		return starlark.None, nil
+	}).BindReceiver(node), nil
+}
+
+func (node *sNodeSequence) append(value starlark.Value) error {
+	ynode, err := slToYNode(value)
+	if err != nil {
+		return err
+	}
+
+	node.YNode().Content = append(node.YNode().Content, ynode)
+
+	return nil
+}
+
+func (node *sNodeSequence) extend(value starlark.Value) error {
+	values, ok := value.(starlark.Iterable)
+	if !ok {
+		return fmt.Errorf("%w: %s", errUnsupportedValue, value.Type())
+	}
+
+	for element := range slListAll(values) {
+		if err := node.append(element); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remove removes the first element equal to the value.
+func (node *sNodeSequence) remove(value starlark.Value) error {
+	ynode, err := slToYNode(value)
+	if err != nil {
+		return err
+	}
+
+	want, err := yaml.String(ynode, yaml.Flow)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUnsupportedValue, err)
+	}
+
+	content := node.YNode().Content
+	for idx, element := range content {
+		if got, err := yaml.String(element, yaml.Flow); err == nil && got == want {
+			node.YNode().Content = slices.Delete(content, idx, idx+1)
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", errNotFound, strings.TrimSpace(want))
+}
+
+// sNodeMapping is a mapping of the resource. The resources are subscripted
+// by the query paths, e.g. r["spec.replicas"], the nested mappings by the
+// literal keys, e.g. r.metadata.annotations["example.com/x"].
 type sNodeMapping struct {
 	*sNode
+
+	paths bool
+}
+
+// literalKey returns the key of the nested mapping.
+func literalKey(key starlark.Value) (string, error) {
+	name, ok := starlark.AsString(key)
+	if !ok {
+		return "", fmt.Errorf("%w: %s key", errUnsupportedValue, key.Type())
+	}
+
+	return name, nil
 }
 
 func (node *sNodeMapping) match(path resource.Query, create yaml.Kind) (*yaml.RNode, error) {
@@ -194,6 +609,20 @@ func (node *sNodeMapping) match(path resource.Query, create yaml.Kind) (*yaml.RN
 }
 
 func (node *sNodeMapping) Get(key starlark.Value) (starlark.Value, bool, error) {
+	if !node.paths {
+		name, err := literalKey(key)
+		if err != nil {
+			return nil, false, err
+		}
+
+		field := node.Field(name)
+		if field.IsNilOrEmpty() {
+			return nil, false, nil
+		}
+
+		return newSNode(field.Value), true, nil
+	}
+
 	path, err := slToQuery(key)
 	if err != nil {
 		return nil, false, err
@@ -251,10 +680,90 @@ func (node *sNodeMapping) Items() []starlark.Tuple {
 	return tuples
 }
 
-func (node *sNodeMapping) SetKey(k, v starlark.Value) error {
+// SetKey sets the fields matching the query path, the missing parents are
+// created. The None value removes the fields. The nested mappings set the
+// field of the literal key.
+func (node *sNodeMapping) SetKey(key, value starlark.Value) error {
+	ynode, err := slToYNode(value)
+	if err != nil {
+		return err
+	}
+
+	if isNull(ynode) {
+		return node.clear(key)
+	}
+
+	if !node.paths {
+		name, err := literalKey(key)
+		if err != nil {
+			return err
+		}
+
+		return setField(node.RNode, name, ynode)
+	}
+
+	path, err := slToQuery(key)
+	if err != nil {
+		return err
+	}
+
+	if len(path) == 0 || yaml.IsListIndex(path[len(path)-1]) || yaml.IsWildcard(path[len(path)-1]) {
+		return fmt.Errorf("%w: %s", errUnsupportedSet, path)
+	}
+
+	parents := []*yaml.RNode{node.RNode}
+
+	if parentPath := path[:len(path)-1]; len(parentPath) > 0 {
+		matches, err := node.match(parentPath, yaml.MappingNode)
+		if err != nil {
+			return err
+		}
+
+		parents = []*yaml.RNode{}
+		for _, match := range matches.Content() {
+			parents = append(parents, yaml.NewRNode(match))
+		}
+	}
+
+	for idx, parent := range parents {
+		value := ynode
+		if idx > 0 {
+			value = yaml.CopyYNode(ynode)
+		}
+
+		if err := setField(parent, path[len(path)-1], value); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func (node *sNodeMapping) clear(key starlark.Value) error {
+	if !node.paths {
+		name, err := literalKey(key)
+		if err != nil {
+			return err
+		}
+
+		_, err = node.Pipe(yaml.Clear(name))
+
+		return err //nolint:wrapcheck
+	}
+
+	path, err := slToQuery(key)
+	if err != nil {
+		return err
+	}
+
+	clear, err := ClearAll(path)
+	if err != nil {
+		return err
+	}
+
+	return node.PipeE(clear) //nolint:wrapcheck
+}
+
 func (node *sNodeMapping) AttrNames() []string {
 	names, _ := node.Fields()
 	return names
@@ -270,12 +779,12 @@ func (node *sNodeMapping) Attr(name string) (starlark.Value, error) {
 }
 
 func (node *sNodeMapping) SetField(name string, value starlark.Value) error {
-	rnode, err := yaml.Parse(strings.TrimSpace(value.String()))
+	ynode, err := slToYNode(value)
 	if err != nil {
 		return err
 	}
 
-	return node.PipeE(yaml.SetField(name, rnode))
+	return setField(node.RNode, name, ynode)
 }
 
 func slToQuery(key starlark.Value) (resource.Query, error) {
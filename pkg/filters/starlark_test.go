@@ -5,7 +5,9 @@ import (
 	"testing"
 
 	"github.com/Mirantis/ktl/pkg/filters"
+	"github.com/Mirantis/ktl/pkg/types"
 	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/resid"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
@@ -36,21 +38,21 @@ a:
   d:
   - k: dk1
     v:
-      "k": "new-dv1"
+      k: new-dv1
     old: dv1
   - k: dk2
     v:
-      "k": "new-dv2"
+      k: new-dv2
     old: dv2
-    match: "found"
+    match: found
 ---
 e: f
 ---
 g: h
 i: 1
 ---
-"x": "y"
-"z": 0
+x: y
+z: 0
 `
 	filter := &filters.StarlarkFilter{
 		Script: `
@@ -91,3 +93,239 @@ output.append({
 		t.Fatalf("+got -want:\n%s", diff)
 	}
 }
+
+func TestStarlarkCluster(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"env=dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"env=prod"}})
+
+	filter := &filters.StarlarkFilter{
+		Script: `
+for r in resources:
+  r.cluster = cluster.name
+  r.env = cluster.labels["env"]
+  r.fleet = ",".join(sorted(clusters.keys()))
+output.extend(resources)
+`,
+	}
+
+	rnodes, err := filter.ForCluster(clusters, prodA).Filter([]*yaml.RNode{yaml.MustParse(`a: b`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `a: b
+cluster: prod-a
+env: prod
+fleet: dev-a,prod-a
+`
+
+	if diff := cmp.Diff(want, rnodes[0].MustString()); diff != "" {
+		t.Fatalf("+got -want:\n%s", diff)
+	}
+}
+
+func TestStarlarkFleet(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a"})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a"})
+	config := yaml.MustParse(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  timeout: 10s
+`)
+	resources := &types.ClusterResources{
+		Clusters: clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{
+			resid.FromRNode(config): {
+				devA:  config.Copy(),
+				prodA: yaml.MustParse(strings.Replace(config.MustString(), "10s", "10000ms", 1)),
+			},
+		},
+	}
+
+	filter := &filters.StarlarkFilter{
+		Fleet: true,
+		Script: `
+for id, by_cluster in resources.items():
+  values = [r.data.timeout for r in by_cluster.values()]
+  for r in by_cluster.values():
+    r.data.timeout = values[0]
+`,
+	}
+
+	if rnodes, err := filter.ForCluster(clusters, devA).Filter([]*yaml.RNode{config}); err != nil || len(rnodes) != 1 {
+		t.Fatalf("fleet filter changed the cluster resources: %v", err)
+	}
+
+	if err := filter.FilterFleet(resources); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rnode := range resources.Cluster(devA) {
+		if got, _ := rnode.GetString("data.timeout"); got != "10s" {
+			t.Errorf("got %s, want 10s", got)
+		}
+	}
+
+	for _, rnode := range resources.Cluster(prodA) {
+		if got, _ := rnode.GetString("data.timeout"); got != "10s" {
+			t.Errorf("got %s, want 10s", got)
+		}
+	}
+}
+
+func TestStarlarkFleetOrder(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	clusterIDs := []types.ClusterID{}
+
+	for _, name := range []string{"test-a", "prod-b", "dev-a", "prod-a"} {
+		clusterIDs = append(clusterIDs, clusters.Add(types.Cluster{Name: name}))
+	}
+
+	filter := &filters.StarlarkFilter{
+		Fleet: true,
+		Script: `
+ids = ",".join(resources.keys())
+for id, by_cluster in resources.items():
+  names = ",".join(by_cluster.keys())
+  for r in by_cluster.values():
+    r.data.ids = ids
+    r.data.clusters = names
+`,
+	}
+
+	for range 10 {
+		resources := &types.ClusterResources{
+			Clusters:  clusters,
+			Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{},
+		}
+
+		for _, name := range []string{"c", "a", "b"} {
+			config := yaml.MustParse("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + name + "\ndata:\n  key: value\n")
+			byCluster := map[types.ClusterID]*yaml.RNode{}
+
+			for _, id := range clusterIDs {
+				byCluster[id] = config.Copy()
+			}
+
+			resources.Resources[resid.FromRNode(config)] = byCluster
+		}
+
+		if err := filter.FilterFleet(resources); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, rnode := range resources.Cluster(clusterIDs[0]) {
+			data := rnode.GetDataMap()
+			wantIDs := "ConfigMap.v1.[noGrp]/a.[noNs],ConfigMap.v1.[noGrp]/b.[noNs],ConfigMap.v1.[noGrp]/c.[noNs]"
+
+			if data["ids"] != wantIDs || data["clusters"] != "dev-a,prod-a,prod-b,test-a" {
+				t.Fatalf("unexpected keys order: %v", data)
+			}
+		}
+	}
+}
+
+func TestStarlarkDottedKeys(t *testing.T) {
+	input := []*yaml.RNode{yaml.MustParse(`
+metadata:
+  annotations:
+    example.com/x: old
+    example.com/y: remove
+    example.com/z: keep
+`)}
+	want := `metadata:
+  annotations:
+    example.com/x: new
+    example.com/z: keep-copy
+    example.com/new: created
+`
+	filter := &filters.StarlarkFilter{
+		Script: `
+for r in resources:
+  annotations = r.metadata.annotations
+  annotations["example.com/x"] = "new"
+  annotations["example.com/new"] = "created"
+  annotations["example.com/z"] = "%s-copy" % annotations["example.com/z"]
+  delete(annotations, "example.com/y")
+  if "example.com/missing" in annotations:
+    annotations["example.com/missing"] = None
+output.extend(resources)
+`,
+	}
+
+	rnodes, err := filter.Filter(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, rnodes[0].MustString()); diff != "" {
+		t.Fatalf("+got -want:\n%s", diff)
+	}
+}
+
+func TestStarlarkMutation(t *testing.T) {
+	input := []*yaml.RNode{yaml.MustParse(`
+metadata:
+  annotations:
+    x: "1"
+    y: "2"
+spec:
+  args: [a, b, c]
+  ports:
+  - name: http
+  - name: https
+`)}
+	want := `metadata:
+  annotations:
+    y: "2"
+spec:
+  args: [a, c, d, e, f]
+  ports:
+  - name: http
+    port: 80
+  - name: https
+    port: 80
+  replicas: 3
+  enabled: true
+  version: "3"
+  template:
+    spec:
+      labels:
+        app: x
+      tolerations: []
+  strategy:
+    type: Recreate
+`
+	filter := &filters.StarlarkFilter{
+		Script: `
+for r in resources:
+  r["spec.replicas"] = 3
+  r.spec.enabled = True
+  r.spec.version = "3"
+  r["spec.template.spec.labels"] = {"app": "x"}
+  r["spec.template.spec.tolerations"] = []
+  r["spec.ports.*.port"] = 80
+  r.spec.strategy = {"type": "Rolling"}
+  r.spec.strategy.type = "Recreate"
+  r.spec.args.remove("b")
+  r.spec.args.append("d")
+  r.spec.args.extend(["e", "f"])
+  delete(r, "metadata.annotations.x")
+  r["metadata.annotations.z"] = None
+output.extend(resources)
+`,
+	}
+
+	rnodes, err := filter.Filter(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, rnodes[0].MustString()); diff != "" {
+		t.Fatalf("+got -want:\n%s", diff)
+	}
+}
@@ -94,9 +94,11 @@ func (cmd *Cmd) Get(resources []string, namespace string, selectors []string, na
 		args = append(args, "-l", strings.Join(selectors, ","))
 	}
 
-	if namespace != "" {
+	// the names without a namespace select the cluster scoped resources
+	switch {
+	case namespace != "":
 		args = append(args, "-n", namespace)
-	} else {
+	case len(names) == 0:
 		args = append(args, "-A")
 	}
 
@@ -120,6 +122,18 @@ func (cmd *Cmd) APIResources(namespaced bool) ([]string, error) {
 	return resources, err
 }
 
+// APIResourceKinds returns the api resources of the cluster with their kinds
+// and short names.
+func (cmd *Cmd) APIResourceKinds() ([]APIResource, error) {
+	subcmd := cmd.SubCmd(
+		"api-resources",
+		"--verbs", "get",
+		"--no-headers",
+	)
+
+	return executeCmd(subcmd, parseAPIResources, nil)
+}
+
 func (cmd *Cmd) Namespaces() ([]string, error) {
 	subcmd := cmd.SubCmd(
 		"get", "namespaces",
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 
 	"sigs.k8s.io/kustomize/kyaml/kio"
@@ -60,3 +62,61 @@ func jsonParser[T any](dst T, def T) parserFn[T] {
 		return dst, nil
 	}
 }
+
+// APIResource is a line of the api-resources output.
+type APIResource struct {
+	Name       string
+	ShortNames []string
+	Group      string
+	Kind       string
+}
+
+// FullName returns the resource name qualified with the group, e.g.
+// "deployments.apps", as listed by "api-resources -o name".
+func (res APIResource) FullName() string {
+	if res.Group == "" {
+		return res.Name
+	}
+
+	return res.Name + "." + res.Group
+}
+
+var errAPIResourceLine = errors.New("unexpected api-resources line")
+
+// parseAPIResources parses the NAME, SHORTNAMES, APIVERSION, NAMESPACED and
+// KIND columns, the short names are optional.
+func parseAPIResources(data []byte) ([]APIResource, error) {
+	lines, err := parseLines(data)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []APIResource{}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		res := APIResource{}
+
+		switch len(fields) {
+		case 4: //nolint:mnd
+			res.Name = fields[0]
+		case 5: //nolint:mnd
+			res.Name = fields[0]
+			res.ShortNames = strings.Split(fields[1], ",")
+		case 0:
+			continue
+		default:
+			return nil, fmt.Errorf("%w: %q", errAPIResourceLine, line)
+		}
+
+		apiVersion, kind := fields[len(fields)-3], fields[len(fields)-1]
+		if group, _, found := strings.Cut(apiVersion, "/"); found {
+			res.Group = group
+		}
+
+		res.Kind = kind
+		resources = append(resources, res)
+	}
+
+	return resources, nil
+}
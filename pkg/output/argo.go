@@ -0,0 +1,289 @@
+package output
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ArgoGenerator defines how the ApplicationSet enumerates the clusters.
+type ArgoGenerator string
+
+const (
+	// ListGenerator lists every cluster with its overlay path and labels.
+	ListGenerator ArgoGenerator = "list"
+	// ClustersGenerator selects the Argo CD clusters labeled with the
+	// cluster name, e.g. "cluster: prod-a".
+	ClustersGenerator ArgoGenerator = "clusters"
+)
+
+const (
+	defaultArgoName      = "fleet"
+	defaultArgoNamespace = "argocd"
+	defaultArgoProject   = "default"
+	defaultArgoRevision  = "HEAD"
+	defaultArgoPath      = "applicationset.yaml"
+	clusterLabel         = "cluster"
+)
+
+var (
+	errUnsupportedGenerator = errors.New("unsupported generator")
+	errUnsupportedArgo      = errors.New("output has no cluster overlays")
+	errMissingRepoURL       = errors.New("repoURL is required")
+	errClusterPath          = errors.New("overlay paths must only vary by the cluster name")
+)
+
+func (gen *ArgoGenerator) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid generator: %w", err)
+	}
+
+	switch value := ArgoGenerator(raw); value {
+	case "", ListGenerator, ClustersGenerator:
+		*gen = value
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedGenerator, raw)
+	}
+
+	return nil
+}
+
+// ArgoOutput stores the wrapped output and an Argo CD ApplicationSet
+// deploying its cluster overlays.
+type ArgoOutput struct {
+	// Output is the wrapped components or helm chart output.
+	Output         Impl          `yaml:"-"`
+	Name           string        `yaml:"name"`
+	Namespace      string        `yaml:"namespace"`
+	Project        string        `yaml:"project"`
+	RepoURL        string        `yaml:"repoURL"`
+	TargetRevision string        `yaml:"targetRevision"`
+	Generator      ArgoGenerator `yaml:"generator"`
+	Path           string        `yaml:"path"`
+}
+
+type argoSource struct {
+	RepoURL        string `yaml:"repoURL"`
+	TargetRevision string `yaml:"targetRevision"`
+	Path           string `yaml:"path"`
+}
+
+type argoDestination struct {
+	Name string `yaml:"name"`
+}
+
+type argoAppSpec struct {
+	Project     string          `yaml:"project"`
+	Source      argoSource      `yaml:"source"`
+	Destination argoDestination `yaml:"destination"`
+}
+
+type argoTemplate struct {
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec argoAppSpec `yaml:"spec"`
+}
+
+type argoListElement struct {
+	Name   string            `yaml:"name"`
+	Path   string            `yaml:"path"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+type argoSelector struct {
+	MatchExpressions []map[string]any `yaml:"matchExpressions"`
+}
+
+type argoListGenerator struct {
+	Elements []argoListElement `yaml:"elements"`
+}
+
+type argoClustersGenerator struct {
+	Selector argoSelector `yaml:"selector"`
+}
+
+type argoGenerator struct {
+	List     *argoListGenerator     `yaml:"list,omitempty"`
+	Clusters *argoClustersGenerator `yaml:"clusters,omitempty"`
+}
+
+type argoAppSet struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		GoTemplate        bool            `yaml:"goTemplate"`
+		GoTemplateOptions []string        `yaml:"goTemplateOptions"`
+		Generators        []argoGenerator `yaml:"generators"`
+		Template          argoTemplate    `yaml:"template"`
+		TemplatePatch     string          `yaml:"templatePatch"`
+	} `yaml:"spec"`
+}
+
+// clusterLabels returns the cluster name and labels, the plain tags are
+// labeled "true".
+func clusterLabels(cluster types.Cluster) map[string]string {
+	labels := map[string]string{clusterLabel: cluster.Name}
+	for key, value := range cluster.Labels() {
+		labels[key] = cmp.Or(value, "true")
+	}
+
+	return labels
+}
+
+// overlaysPath returns the overlays path template of the wrapped output.
+func overlaysPath(impl Impl) (types.PathTemplate, error) {
+	switch out := impl.(type) {
+	case *ComponentsOutput:
+		return out.Paths.withDefaults().Overlays, nil
+	case *ChartOutput:
+		if out.OverlayStyle != "" && out.OverlayStyle != KustomizeOverlays {
+			return "", fmt.Errorf("%w: %s overlay style", errUnsupportedArgo, out.OverlayStyle)
+		}
+
+		return out.Paths.withDefaults().Overlays, nil
+	default:
+		return "", fmt.Errorf("%w: %T", errUnsupportedArgo, impl)
+	}
+}
+
+// clusterPathTemplate returns the overlay path as an ApplicationSet template
+// of the cluster name.
+func clusterPathTemplate(overlays types.PathTemplate, clusters *types.ClusterIndex) (string, error) {
+	const placeholder = "{{ .name }}"
+
+	var prefix, suffix string
+
+	for _, cluster := range clusters.All() {
+		path := overlays.Expand(types.PathVars{Cluster: &cluster})
+
+		idx := strings.Index(path, cluster.Name)
+		if idx < 0 {
+			return "", fmt.Errorf("%w: %s", errClusterPath, path)
+		}
+
+		if prefix == "" && suffix == "" {
+			prefix, suffix = path[:idx], path[idx+len(cluster.Name):]
+		}
+
+		if path != prefix+cluster.Name+suffix {
+			return "", fmt.Errorf("%w: %s", errClusterPath, path)
+		}
+	}
+
+	return prefix + placeholder + suffix, nil
+}
+
+func (out *ArgoOutput) appSet(clusters *types.ClusterIndex) (*argoAppSet, error) {
+	overlays, err := overlaysPath(out.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	appSet := &argoAppSet{APIVersion: "argoproj.io/v1alpha1", Kind: "ApplicationSet"}
+	appSet.Metadata.Name = withDefault(out.Name, defaultArgoName)
+	appSet.Metadata.Namespace = withDefault(out.Namespace, defaultArgoNamespace)
+	appSet.Spec.GoTemplate = true
+	appSet.Spec.GoTemplateOptions = []string{"missingkey=error"}
+
+	tmpl := &appSet.Spec.Template
+	tmpl.Metadata.Name = appSet.Metadata.Name + "-{{ .name }}"
+	tmpl.Spec.Project = withDefault(out.Project, defaultArgoProject)
+	tmpl.Spec.Destination.Name = "{{ .name }}"
+	tmpl.Spec.Source = argoSource{
+		RepoURL:        out.RepoURL,
+		TargetRevision: withDefault(out.TargetRevision, defaultArgoRevision),
+		Path:           "{{ .path }}",
+	}
+	appSet.Spec.TemplatePatch = "metadata:\n  labels:\n    {{- toYaml .labels | nindent 4 }}\n"
+
+	generator := argoGenerator{}
+
+	if out.Generator == ClustersGenerator {
+		tmpl.Spec.Source.Path, err = clusterPathTemplate(overlays, clusters)
+		if err != nil {
+			return nil, err
+		}
+
+		names := []string{}
+		for _, cluster := range clusters.All() {
+			names = append(names, cluster.Name)
+		}
+
+		generator.Clusters = &argoClustersGenerator{
+			Selector: argoSelector{
+				MatchExpressions: []map[string]any{
+					{"key": clusterLabel, "operator": "In", "values": names},
+				},
+			},
+		}
+		appSet.Spec.TemplatePatch = "metadata:\n  labels:\n    {{- toYaml .metadata.labels | nindent 4 }}\n"
+	} else {
+		generator.List = &argoListGenerator{}
+
+		for _, cluster := range clusters.All() {
+			generator.List.Elements = append(generator.List.Elements, argoListElement{
+				Name:   cluster.Name,
+				Path:   overlays.Expand(types.PathVars{Cluster: &cluster}),
+				Labels: clusterLabels(cluster),
+			})
+		}
+	}
+
+	appSet.Spec.Generators = []argoGenerator{generator}
+
+	return appSet, nil
+}
+
+func withDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
+func (out *ArgoOutput) Store(env *types.Env, resources *types.ClusterResources) error {
+	if out.RepoURL == "" {
+		return errMissingRepoURL
+	}
+
+	appSet, err := out.appSet(resources.Clusters)
+	if err != nil {
+		return err
+	}
+
+	if err := out.Output.Store(env, resources); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	body, err := yaml.Marshal(appSet)
+	if err != nil {
+		return fmt.Errorf("unable to generate ApplicationSet: %w", err)
+	}
+
+	path := withDefault(out.Path, defaultArgoPath)
+	if err := env.FileSys.WriteFile(path, body); err != nil {
+		return fmt.Errorf("unable to store %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (out *ArgoOutput) Render(env *types.Env, clusters *types.ClusterIndex) (map[types.ClusterID][]*yaml.RNode, error) {
+	renderer, ok := out.Output.(Renderer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrVerifyUnsupported, out.Output)
+	}
+
+	return renderer.Render(env, clusters) //nolint:wrapcheck
+}
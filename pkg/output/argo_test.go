@@ -0,0 +1,140 @@
+package output_test
+
+import (
+	"testing"
+
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestArgoOutput(t *testing.T) {
+	tests := map[string]struct {
+		generator output.ArgoGenerator
+		want      string
+	}{
+		"list": {
+			generator: output.ListGenerator,
+			want: `apiVersion: argoproj.io/v1alpha1
+kind: ApplicationSet
+metadata:
+  name: fleet
+  namespace: argocd
+spec:
+  goTemplate: true
+  goTemplateOptions:
+  - missingkey=error
+  generators:
+  - list:
+      elements:
+      - name: dev-a
+        path: overlays/dev-a
+        labels:
+          cluster: dev-a
+          dev: "true"
+      - name: prod-a
+        path: overlays/prod-a
+        labels:
+          cluster: prod-a
+          prod: "true"
+  template:
+    metadata:
+      name: fleet-{{ .name }}
+    spec:
+      project: default
+      source:
+        repoURL: https://example.com/fleet.git
+        targetRevision: main
+        path: '{{ .path }}'
+      destination:
+        name: '{{ .name }}'
+  templatePatch: |
+    metadata:
+      labels:
+        {{- toYaml .labels | nindent 4 }}
+`,
+		},
+		"clusters": {
+			generator: output.ClustersGenerator,
+			want: `apiVersion: argoproj.io/v1alpha1
+kind: ApplicationSet
+metadata:
+  name: fleet
+  namespace: argocd
+spec:
+  goTemplate: true
+  goTemplateOptions:
+  - missingkey=error
+  generators:
+  - clusters:
+      selector:
+        matchExpressions:
+        - key: cluster
+          operator: In
+          values:
+          - dev-a
+          - prod-a
+  template:
+    metadata:
+      name: fleet-{{ .name }}
+    spec:
+      project: default
+      source:
+        repoURL: https://example.com/fleet.git
+        targetRevision: main
+        path: overlays/{{ .name }}
+      destination:
+        name: '{{ .name }}'
+  templatePatch: |
+    metadata:
+      labels:
+        {{- toYaml .metadata.labels | nindent 4 }}
+`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			clusters := types.NewClusterIndex()
+			devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+			prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+			byCluster := map[types.ClusterID]*yaml.RNode{
+				devA:  yaml.MustParse(appDevA),
+				prodA: yaml.MustParse(appProdA),
+			}
+			resources := &types.ClusterResources{
+				Clusters: clusters,
+				Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{
+					resid.FromRNode(byCluster[devA]): byCluster,
+				},
+			}
+			env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+			out := &output.ArgoOutput{
+				Output:         &output.ComponentsOutput{},
+				RepoURL:        "https://example.com/fleet.git",
+				TargetRevision: "main",
+				Generator:      test.generator,
+			}
+
+			if err := out.Store(env, resources); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := env.FileSys.ReadFile("applicationset.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(test.want, string(got)); diff != "" {
+				t.Errorf("ApplicationSet mismatch, +got -want:\n%s", diff)
+			}
+
+			if !env.FileSys.Exists("overlays/prod-a/kustomization.yaml") {
+				t.Error("wrapped output is not stored")
+			}
+		})
+	}
+}
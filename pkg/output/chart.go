@@ -1,11 +1,11 @@
 package output
 
 import (
-	"bytes"
 	_ "embed"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"iter"
 	"maps"
 	"path/filepath"
 	"slices"
@@ -14,7 +14,6 @@ import (
 	"github.com/Mirantis/ktl/pkg/fsutil"
 	"github.com/Mirantis/ktl/pkg/resource"
 	"github.com/Mirantis/ktl/pkg/types"
-	"k8s.io/apimachinery/pkg/util/rand"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
 	"sigs.k8s.io/kustomize/kyaml/openapi"
 	"sigs.k8s.io/kustomize/kyaml/resid"
@@ -22,8 +21,17 @@ import (
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
+const (
+	chartFileName   = "Chart.yaml"
+	valuesFileName  = "values.yaml"
+	schemaFileName  = "values.schema.json"
+	templatesDir    = "templates"
+	helpersFileName = "_helpers.tpl"
+)
+
 var (
 	errDuplicateResource = errors.New("duplicate resource")
+	errChartPath         = errors.New("chart directory must match the chart name")
 
 	//go:embed data/_helpers.tpl
 	helpersTpl []byte
@@ -31,12 +39,38 @@ var (
 
 type ChartOutput struct {
 	HelmChart types.HelmChart `yaml:"helmChart"`
+	Paths     Paths           `yaml:"paths"`
+	Values    ValuesStyle     `yaml:"values"`
+	// ValueAliases replace the prefixes of the structured value names, e.g.
+	// "deployment.simpleApp: app".
+	ValueAliases ValueAliases `yaml:"valueAliases"`
+	// ValuesSchema enables values.schema.json generation.
+	ValuesSchema bool `yaml:"valuesSchema"`
+	// CommonMetadata moves the labels and annotations shared by the
+	// templates into named templates.
+	CommonMetadata bool `yaml:"commonMetadata"`
+	// Update keeps the edited files and the extra values of the existing
+	// chart, see Chart.Update.
+	Update      bool        `yaml:"update"`
+	VersionBump VersionBump `yaml:"versionBump"`
+	// CollapseThreshold replaces mostly varying subtrees with a single
+	// variable, see Chart.CollapseThreshold.
+	CollapseThreshold float64 `yaml:"collapseThreshold"`
+	// OverlayStyle defines how the chart is deployed to the clusters.
+	OverlayStyle OverlayStyle `yaml:"overlayStyle"`
+
+	chart *Chart
 }
 
 //nolint:lll
 func (out *ChartOutput) storeChartOverlays(env *types.Env, resources *types.ClusterResources, chart *Chart, chartDir string) error {
+	paths := out.Paths.withDefaults()
+	if err := checkOverlayPaths(paths.Overlays, resources.Clusters); err != nil {
+		return err
+	}
+
 	for clusterID, cluster := range resources.Clusters.All() {
-		overlayDir := filepath.Join("overlays", cluster.Name)
+		overlayDir := paths.Overlays.Expand(types.PathVars{Cluster: &cluster})
 		fileStore := resource.FileStore{
 			FileSystem: fsutil.Sub(env.FileSys, overlayDir),
 		}
@@ -63,38 +97,74 @@ func (out *ChartOutput) storeChartOverlays(env *types.Env, resources *types.Clus
 
 func (out *ChartOutput) Store(env *types.Env, resources *types.ClusterResources) error {
 	chartMeta := out.HelmChart
+	paths := out.Paths.withDefaults()
 	chart := NewChart(chartMeta, resources.Clusters)
-	chartDir := filepath.Join("charts", chartMeta.Name)
+	chart.FileTemplate = paths.Resources
+	chart.Values = out.Values
+	chart.ValueAliases = out.ValueAliases
+	chart.ValuesSchema = out.ValuesSchema
+	chart.CommonMetadata = out.CommonMetadata
+	chart.Update = out.Update
+	chart.VersionBump = out.VersionBump
+	chart.CollapseThreshold = out.CollapseThreshold
+	chart.ExternalPresets = out.OverlayStyle != "" && out.OverlayStyle != KustomizeOverlays
+	chartDir := paths.Chart.Expand(types.PathVars{Chart: chartMeta.Name})
+
+	if filepath.Base(chartDir) != chartMeta.Name {
+		return fmt.Errorf("%w: %s", errChartPath, chartDir)
+	}
 	chartFS := fsutil.Sub(env.FileSys, chartDir)
 
 	if err := chartFS.MkdirAll("."); err != nil {
 		return fmt.Errorf("unable to create charts dir: %w", err)
 	}
 
-	for id, byCluster := range resources.Resources {
-		if err := chart.Add(id, byCluster); err != nil {
+	for _, id := range resources.IDs() {
+		if err := chart.Add(id, resources.Resources[id]); err != nil {
 			return fmt.Errorf("unable to add resources to the chart: %w", err)
 		}
 	}
 
+	out.chart = chart
+
 	if err := chart.Store(chartFS, "."); err != nil {
 		return fmt.Errorf("unable to store the chart: %w", err)
 	}
 
-	return out.storeChartOverlays(env, resources, chart, chartDir)
+	switch out.OverlayStyle {
+	case HelmfileOverlays:
+		if err := out.storeValuesFiles(env, resources, chart); err != nil {
+			return err
+		}
+
+		return out.storeHelmfile(env, resources, chart, chartDir)
+	case ValuesOverlays:
+		return out.storeValuesFiles(env, resources, chart)
+	default:
+		return out.storeChartOverlays(env, resources, chart, chartDir)
+	}
 }
 
 type chartValues map[string]*yaml.Node
 
-func (cv chartValues) asMap() map[string]any {
+func (cv chartValues) node(style ValuesStyle) *yaml.RNode {
+	if style == StructuredValues {
+		return nestedValues(cv)
+	}
+
 	rNode := yaml.NewMapRNode(nil)
-	for name, value := range cv {
-		if err := rNode.SetMapField(yaml.NewRNode(value), name); err != nil {
+
+	for _, name := range slices.Sorted(maps.Keys(cv)) {
+		if err := rNode.SetMapField(yaml.NewRNode(cv[name]), name); err != nil {
 			panic(err)
 		}
 	}
 
-	body, err := rNode.MarshalJSON()
+	return rNode
+}
+
+func (cv chartValues) asMap(style ValuesStyle) map[string]any {
+	body, err := cv.node(style).MarshalJSON()
 	if err != nil {
 		panic(err)
 	}
@@ -108,119 +178,214 @@ func (cv chartValues) asMap() map[string]any {
 }
 
 type Chart struct {
+	// FileTemplate defines template file names, relative to the templates
+	// directory.
+	FileTemplate types.PathTemplate
+	Values       ValuesStyle
+	// ValueAliases replace the prefixes of the structured value names.
+	ValueAliases ValueAliases
+	// ValuesSchema enables values.schema.json inferred from the observed
+	// values.
+	ValuesSchema bool
+	// CommonMetadata replaces the constant labels and annotations repeated
+	// in most of the templates with includes of "<chart>.labels" and
+	// "<chart>.annotations" defined in _helpers.tpl.
+	CommonMetadata bool
+	// Update merges the chart into the existing one: the templates edited
+	// since the last run, Chart.yaml fields and extra values are kept, the
+	// version is bumped according to VersionBump if anything changed.
+	Update      bool
+	VersionBump VersionBump
+	// CollapseThreshold, if set, replaces subtrees with a single variable,
+	// when the share of the varying or optional leaves reaches the threshold,
+	// e.g. 0.5 for a half of the leaves.
+	CollapseThreshold float64
+	// ExternalPresets omits the preset values from values.yaml, they are
+	// stored in separate values files instead, see PresetValues.
+	ExternalPresets bool
+
 	meta      types.HelmChart
 	templates map[resid.ResId]*yaml.RNode
 
-	token          string
+	directives     map[*yaml.Node]*directive
 	presetValues   map[string]chartValues
 	inlineValues   map[types.ClusterID]chartValues
 	clusterPresets map[types.ClusterID]sets.String
 	clusters       *types.ClusterIndex
 	clusterIDs     []types.ClusterID
+	names          *valueNames
+	variables      sets.String
+	required       sets.String
+	schemas        map[string]jsonSchema
 }
 
 func NewChart(meta types.HelmChart, clusters *types.ClusterIndex) *Chart {
-	const tokenLen = 8
 	chart := &Chart{
 		meta:           meta,
 		clusters:       clusters,
 		clusterIDs:     clusters.IDs(),
-		token:          rand.String(tokenLen),
+		directives:     map[*yaml.Node]*directive{},
 		presetValues:   map[string]chartValues{},
 		inlineValues:   map[types.ClusterID]chartValues{},
 		clusterPresets: map[types.ClusterID]sets.String{},
 		templates:      map[resid.ResId]*yaml.RNode{},
+		variables:      sets.String{},
+		required:       sets.String{},
+		schemas:        map[string]jsonSchema{},
 	}
 
 	return chart
 }
 
 func (chart *Chart) templateName(id resid.ResId) string {
+	if chart.FileTemplate != "" {
+		return chart.FileTemplate.Expand(types.PathVars{Chart: chart.meta.Name, ResID: &id})
+	}
+
 	return strings.ToLower(fmt.Sprintf("%s-%s.yaml", id.Name, id.Kind))
 }
 
-func (chart *Chart) storeTemplates(fileSys filesys.FileSystem, dir string) error {
-	templatePrefix := []byte("# HELM" + chart.token + ": ")
-	store := &resource.FileStore{
-		FileSystem:    fsutil.Sub(fileSys, filepath.Join(dir, "templates")),
-		NameGenerator: chart.templateName,
-		PostProcessor: func(_ string, body []byte) []byte {
-			return bytes.ReplaceAll(body, templatePrefix, []byte{})
-		},
+// template returns the helm template of the resource.
+func (chart *Chart) template(resID resid.ResId) string {
+	mergeTemplate := "merge_presets"
+	if chart.Values == StructuredValues {
+		mergeTemplate = "merge_preset_values"
 	}
 
-	const errMsgTemplates = "unable to store templates"
+	writer := &templateWriter{directives: chart.directives}
 
-	err := store.WriteAll(maps.All(chart.templates))
-	if err != nil {
-		return fmt.Errorf("%s: %w", errMsgTemplates, err)
+	return writer.document(chart.templates[resID].YNode(), fmt.Sprintf(`{{- include "%s" . -}}`, mergeTemplate))
+}
+
+// templateFiles returns the chart templates and helpers, relative to the
+// chart directory.
+func (chart *Chart) templateFiles() map[string][]byte {
+	files := map[string][]resid.ResId{}
+	helpers := helpersTpl
+
+	if chart.CommonMetadata {
+		helpers = append(slices.Clone(helpersTpl), chart.extractCommonMetadata()...)
 	}
 
-	err = store.WriteFile("_helpers.tpl", helpersTpl)
-	if err != nil {
-		return fmt.Errorf("%s: %w", errMsgTemplates, err)
+	for resID := range chart.templates {
+		name := chart.templateName(resID)
+		files[name] = append(files[name], resID)
 	}
 
-	return nil
+	result := map[string][]byte{
+		filepath.Join(templatesDir, helpersFileName): helpers,
+	}
+
+	for name, resIDs := range files {
+		slices.SortFunc(resIDs, func(a, b resid.ResId) int {
+			return strings.Compare(a.String(), b.String())
+		})
+
+		docs := []string{}
+		for _, resID := range resIDs {
+			docs = append(docs, chart.template(resID))
+		}
+
+		result[filepath.Join(templatesDir, name)] = []byte(strings.Join(docs, "---\n"))
+	}
+
+	return result
 }
 
-func (chart *Chart) storeValues(fileSys filesys.FileSystem, dir string) error {
+func (chart *Chart) valuesYAML() *yaml.RNode {
 	presets := yaml.NewMapRNode(nil)
 
 	presetNames := slices.Sorted(maps.Keys(chart.presetValues))
 	for _, presetName := range presetNames {
-		vars := chart.presetValues[presetName]
-		preset := yaml.NewMapRNode(nil)
-
-		varNames := slices.Sorted(maps.Keys(vars))
-		for _, varName := range varNames {
-			value := yaml.NewRNode(vars[varName])
-			if err := preset.SetMapField(value, varName); err != nil {
-				panic(err)
-			}
+		preset := chart.presetValues[presetName].node(chart.Values)
+		if err := presets.SetMapField(preset, presetName); err != nil {
+			panic(err)
 		}
+	}
 
-		if err := presets.SetMapField(preset, presetName); err != nil {
+	root := chart.defaultValues()
+	if !chart.ExternalPresets {
+		if err := root.SetMapField(presets, presetValuesKey); err != nil {
 			panic(err)
 		}
 	}
 
+	return root
+}
+
+// defaultValues returns the values.yaml skeleton: the global map for the flat
+// style, or empty parent mappings of all structured values, so that the
+// templates can reference missing values.
+func (chart *Chart) defaultValues() *yaml.RNode {
 	root := yaml.NewMapRNode(nil)
-	if err := root.SetMapField(yaml.NewMapRNode(nil), "global"); err != nil {
-		panic(err)
+
+	if chart.Values != StructuredValues {
+		if err := root.SetMapField(yaml.NewMapRNode(nil), "global"); err != nil {
+			panic(err)
+		}
+
+		return root
 	}
 
-	if err := root.SetMapField(presets, "preset_values"); err != nil {
-		panic(err)
+	for _, name := range slices.Sorted(maps.Keys(chart.variables)) {
+		path := strings.Split(name, ".")
+		if _, err := root.Pipe(yaml.LookupCreate(yaml.MappingNode, path[:len(path)-1]...)); err != nil {
+			panic(err)
+		}
 	}
 
-	err := fileSys.WriteFile(filepath.Join(dir, "values.yaml"), []byte(root.MustString()))
+	return root
+}
+
+func (chart *Chart) chartYAML() []byte {
+	metaBytes, err := yaml.Marshal(chart.meta)
 	if err != nil {
-		return fmt.Errorf("unable to store values: %w", err)
+		panic(err)
 	}
 
-	return nil
+	return append([]byte("apiVersion: v2\n"), metaBytes...)
 }
 
-func (chart *Chart) Store(fileSys filesys.FileSystem, dir string) error {
-	if err := chart.storeTemplates(fileSys, dir); err != nil {
-		return err
+// files returns the generated chart files, relative to the chart directory.
+func (chart *Chart) files() (map[string][]byte, error) {
+	files := chart.templateFiles()
+	files[valuesFileName] = []byte(chart.valuesYAML().MustString())
+	files[chartFileName] = chart.chartYAML()
+
+	if chart.ValuesSchema {
+		body, err := chart.schemaJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		files[schemaFileName] = body
 	}
 
-	if err := chart.storeValues(fileSys, dir); err != nil {
+	return files, nil
+}
+
+func (chart *Chart) Store(fileSys filesys.FileSystem, dir string) error {
+	files, err := chart.files()
+	if err != nil {
 		return err
 	}
 
-	metaBytes, err := yaml.Marshal(chart.meta)
-	if err != nil {
-		panic(err)
+	if chart.Update {
+		files, err = chart.update(fileSys, dir, files)
+		if err != nil {
+			return fmt.Errorf("unable to update the chart: %w", err)
+		}
 	}
 
-	body := "apiVersion: v2\n" + string(metaBytes)
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		fullPath := filepath.Join(dir, path)
+		if err := fileSys.MkdirAll(filepath.Dir(fullPath)); err != nil {
+			return fmt.Errorf("unable to create chart dir: %w", err)
+		}
 
-	err = fileSys.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(body))
-	if err != nil {
-		return fmt.Errorf("unable to store chart: %w", err)
+		if err := fileSys.WriteFile(fullPath, files[path]); err != nil {
+			return fmt.Errorf("unable to store %s: %w", path, err)
+		}
 	}
 
 	return nil
@@ -231,11 +396,17 @@ func (chart *Chart) Instance(cluster types.ClusterID) types.HelmChart {
 
 	helmChart.ValuesInline = map[string]any{}
 	if presets, found := chart.clusterPresets[cluster]; found {
-		helmChart.ValuesInline["presets"] = slices.Sorted(maps.Keys(presets))
+		helmChart.ValuesInline[presetsKey] = slices.Sorted(maps.Keys(presets))
 	}
 
-	if inline, found := chart.inlineValues[cluster]; found {
-		helmChart.ValuesInline["global"] = inline.asMap()
+	inline, found := chart.inlineValues[cluster]
+
+	switch {
+	case !found:
+	case chart.Values == StructuredValues:
+		maps.Copy(helmChart.ValuesInline, inline.asMap(chart.Values))
+	default:
+		helmChart.ValuesInline["global"] = inline.asMap(chart.Values)
 	}
 
 	return helmChart
@@ -264,6 +435,12 @@ func (chart *Chart) Add(resID resid.ResId, resources map[types.ClusterID]*yaml.R
 	}
 
 	schema := openapi.SchemaForResourceType(resID.AsTypeMeta())
+
+	collapsed, err := collapsedPaths(resources, schema, chart.CollapseThreshold)
+	if err != nil {
+		return fmt.Errorf("chart iterator error: %w", err)
+	}
+
 	resIterator := resource.NewIterator(resources, schema)
 	builder := resource.NewBuilder(resID)
 	occurrences := []int{len(chart.clusterIDs)}
@@ -274,60 +451,212 @@ func (chart *Chart) Add(resID resid.ResId, resources map[types.ClusterID]*yaml.R
 		occurrences = append(occurrences, slices.Repeat([]int{0}, max(0, depth+2-len(occurrences)))...)
 		occurrences[depth+1] = len(resIterator.Clusters())
 		isOptional := occurrences[depth+1] < occurrences[depth]
-		varName := variableName(resID, resIterator.Path())
-		variants := resource.GroupByValue(resIterator.Values())
-		value := chart.value(varName, variants, isOptional)
+
+		var (
+			value *yaml.Node
+			tmpl  *directive
+		)
+
+		if collapsed.Has(path.String()) {
+			resIterator.Skip()
+
+			variants := resource.GroupByValue(resIterator.Nodes())
+			value, tmpl = chart.subtree(resID, path, resIterator.Schema(), variants)
+		} else {
+			variants := resource.GroupByValue(resIterator.Values())
+			if tmpl = chart.metadataTemplate(path, variants, isOptional); tmpl != nil {
+				value = yaml.NewScalarRNode("").YNode()
+			} else {
+				value, tmpl = chart.value(resID, path, resIterator.Schema(), variants, isOptional)
+			}
+		}
 
 		if isOptional {
-			chart.setOptional(varName, value)
+			tmpl.condition = chart.reference(tmpl.variable)
 		}
 
-		_, err := builder.Set(path, value)
+		// the optional children don't render the containers left empty
+		// in some clusters
+		if !collapsed.Has(path.String()) && !resIterator.IsValue() && partlyEmpty(resIterator.Nodes()) {
+			if tmpl == nil {
+				tmpl = &directive{}
+			}
+
+			tmpl.empty = true
+		}
+
+		// the values of the paths present in all clusters are required
+		if tmpl != nil && tmpl.variable != "" && occurrences[depth+1] == len(chart.clusterIDs) {
+			chart.required.Insert(tmpl.variable)
+		}
+
+		resNode, err := builder.Set(path, value)
 		if err != nil {
 			return fmt.Errorf("chart builder error: %w", err)
 		}
+
+		if tmpl != nil {
+			chart.directives[resNode.YNode()] = tmpl
+		}
 	}
 
 	if err := resIterator.Error(); err != nil {
 		return fmt.Errorf("chart iterator error: %w", err)
 	}
 
-	resNode := builder.RNode()
+	chart.templates[resID] = builder.RNode()
+
+	return nil
+}
 
-	headComment := fmt.Sprintf(`HELM%s: {{- include "merge_presets" . -}}`, chart.token)
-	if resNode.YNode().HeadComment != "" {
-		headComment += "\n" + resNode.YNode().HeadComment
+// partlyEmpty reports whether the container is empty in some clusters only.
+func partlyEmpty(nodes iter.Seq2[types.ClusterID, *yaml.Node]) bool {
+	empty, filled := false, false
+
+	for _, node := range nodes {
+		if len(node.Content) == 0 {
+			empty = true
+		} else {
+			filled = true
+		}
 	}
 
-	resNode.YNode().HeadComment = headComment
-	fixComments(resNode.YNode())
-	chart.templates[resID] = resNode
+	return empty && filled
+}
 
-	return nil
+// variable returns the name of a new chart variable for the resource path.
+// Structured names of the optional block flags end with "enabled".
+func (chart *Chart) variable(resID resid.ResId, path resource.Query, flag bool) string {
+	var name string
+
+	switch {
+	case chart.Values != StructuredValues:
+		name = variableName(resID, path)
+	case flag:
+		name = chart.valueNames().name(resID, path, enabledKey)
+	default:
+		name = chart.valueNames().name(resID, path)
+	}
+
+	chart.variables.Insert(name)
+
+	return name
 }
 
-func (chart *Chart) value(variable string, variants []*resource.ValueGroup, optional bool) *yaml.Node {
+func (chart *Chart) valueNames() *valueNames {
+	if chart.names == nil {
+		chart.names = newValueNames(chart.ValueAliases)
+	}
+
+	return chart.names
+}
+
+// reference returns the template expression for the variable value.
+func (chart *Chart) reference(variable string) string {
+	if chart.Values == StructuredValues {
+		return ".Values." + variable
+	}
+
+	return fmt.Sprintf("index .Values.global %q", variable)
+}
+
+//nolint:lll
+func (chart *Chart) value(resID resid.ResId, path resource.Query, schema *openapi.ResourceSchema, variants []*resource.ValueGroup, optional bool) (*yaml.Node, *directive) {
 	if len(variants) == 1 {
 		variant := variants[0]
 		value := variant.Value
 
-		if optional {
-			preset := chart.values(variant.Clusters)
-			preset[variable] = yaml.NewStringRNode("enabled").YNode()
+		if !optional {
+			return value, nil
+		}
+
+		variable := chart.variable(resID, path, true)
+		chart.schemas[variable] = chart.flagSchema()
+		preset := chart.values(variant.Clusters)
+		preset[variable] = yaml.NewStringRNode(enabledKey).YNode()
+		if chart.Values == StructuredValues {
+			preset[variable] = &yaml.Node{Kind: yaml.ScalarNode, Tag: yaml.NodeTagBool, Value: "true"}
 		}
 
-		return value
+		return value, &directive{variable: variable}
 	}
 
+	variable := chart.variants(resID, path, schema, variants)
+	tmpl := &directive{
+		variable: variable,
+		value:    chart.reference(variable),
+		quote:    allStrings(variants),
+		toYaml: slices.ContainsFunc(variants, func(variant *resource.ValueGroup) bool {
+			return hasExponentInts(variant.Value)
+		}),
+	}
+
+	return yaml.NewScalarRNode("").YNode(), tmpl
+}
+
+// allStrings reports whether all the variants are string scalars, these are
+// quoted to keep their type, e.g. "1", and to escape multi-line strings.
+func allStrings(variants []*resource.ValueGroup) bool {
+	for _, variant := range variants {
+		if variant.Value.Kind != yaml.ScalarNode || variant.Value.ShortTag() != yaml.NodeTagString {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasExponentInts reports whether the node holds integers printed in
+// exponent notation once decoded as float64, e.g. 1e+06, as helm and json
+// patches do.
+func hasExponentInts(node *yaml.Node) bool {
+	if node.Kind != yaml.ScalarNode {
+		return slices.ContainsFunc(node.Content, hasExponentInts)
+	}
+
+	if node.ShortTag() != yaml.NodeTagInt {
+		return false
+	}
+
+	var value int64
+	if err := node.Decode(&value); err != nil {
+		return true
+	}
+
+	return value >= 1e6 || value <= -1e6
+}
+
+// subtree replaces the whole varying subtree with a single variable.
+//
+//nolint:lll
+func (chart *Chart) subtree(resID resid.ResId, path resource.Query, schema *openapi.ResourceSchema, variants []*resource.ValueGroup) (*yaml.Node, *directive) {
+	variable := chart.variants(resID, path, schema, variants)
+	tmpl := &directive{
+		variable: variable,
+		value:    chart.reference(variable),
+		subtree:  variants[0].Value.Kind,
+	}
+
+	return yaml.NewScalarRNode("").YNode(), tmpl
+}
+
+//nolint:lll
+func (chart *Chart) variants(resID resid.ResId, path resource.Query, schema *openapi.ResourceSchema, variants []*resource.ValueGroup) string {
+	variable := chart.variable(resID, path, false)
+
+	description := ""
+	if chart.Values == StructuredValues {
+		description = variableName(resID, path)
+	}
+
+	chart.schemas[variable] = variableSchema(schema, variants, description)
+
 	for _, variant := range variants {
 		preset := chart.values(variant.Clusters)
 		preset[variable] = variant.Value
 	}
 
-	node := yaml.NewScalarRNode("").YNode()
-	node.LineComment = fmt.Sprintf("HELM%s: {{ index .Values.global \"%s\" }}", chart.token, variable)
-
-	return node
+	return variable
 }
 
 func (chart *Chart) values(ids []types.ClusterID) chartValues {
@@ -362,72 +691,3 @@ func (chart *Chart) values(ids []types.ClusterID) chartValues {
 
 	return values
 }
-
-func (chart *Chart) setOptional(name string, node *yaml.Node) {
-	node.HeadComment = fmt.Sprintf("HELM%s: {{- if index .Values.global \"%s\" }}", chart.token, name)
-	node.FootComment = fmt.Sprintf("HELM%s: {{- end }} # %s", chart.token, name)
-}
-
-func fixMappingNode(node *yaml.Node) {
-	for i := 0; i < len(node.Content); i += 2 {
-		key, value := node.Content[i], node.Content[i+1]
-		fixComments(value)
-
-		if key.HeadComment != "" && value.HeadComment != "" {
-			key.HeadComment += "\n"
-		}
-
-		if key.FootComment != "" && value.FootComment != "" {
-			value.FootComment += "\n"
-		}
-
-		key.HeadComment += value.HeadComment
-		key.FootComment = value.FootComment + key.FootComment
-		value.HeadComment = ""
-		value.FootComment = ""
-	}
-}
-
-func fixSequenceNode(node *yaml.Node) {
-	nodes := node.Content
-	if len(nodes) < 1 {
-		return
-	}
-
-	for i := range len(node.Content) - 1 {
-		item, nextItem := nodes[i], nodes[i+1]
-		fixComments(item)
-
-		if item.FootComment != "" && nextItem.HeadComment != "" {
-			item.FootComment += "\n"
-		}
-
-		nextItem.HeadComment = item.FootComment + nextItem.HeadComment
-		item.FootComment = ""
-	}
-
-	lastItem := nodes[len(nodes)-1]
-	fixComments(lastItem)
-
-	if node.FootComment != "" && lastItem.FootComment != "" {
-		lastItem.FootComment += "\n"
-	}
-
-	node.FootComment = lastItem.FootComment + node.FootComment
-	lastItem.FootComment = ""
-}
-
-func fixComments(node *yaml.Node) {
-	if node == nil {
-		return
-	}
-
-	switch node.Kind {
-	case yaml.MappingNode:
-		fixMappingNode(node)
-	case yaml.SequenceNode:
-		fixSequenceNode(node)
-	default:
-		return
-	}
-}
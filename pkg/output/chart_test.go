@@ -2,6 +2,9 @@ package output_test
 
 import (
 	"embed"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/Mirantis/ktl/pkg/e2e"
@@ -84,3 +87,755 @@ func TestChart(t *testing.T) {
 		t.Errorf("instances mismatch, +got -want:\n%s", diff)
 	}
 }
+
+//go:embed testdata/chart-structured
+//go:embed testdata/chart-structured/templates/_helpers.tpl
+var chartStructuredFs embed.FS
+
+func TestChartStructuredValues(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	prodB := clusters.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod"}})
+	testA := clusters.Add(types.Cluster{Name: "test-a", Tags: []string{"test"}})
+	testB := clusters.Add(types.Cluster{Name: "test-b", Tags: []string{"test"}})
+	resources := map[types.ClusterID]*yaml.RNode{
+		devA:  yaml.MustParse(appDevA),
+		prodA: yaml.MustParse(appProdA),
+		prodB: yaml.MustParse(appProdB),
+		testA: yaml.MustParse(appTestA),
+		testB: yaml.MustParse(appTestB),
+	}
+
+	meta := types.HelmChart{
+		Name:    "myapp",
+		Version: "v0.1",
+	}
+
+	chart := output.NewChart(meta, clusters)
+	chart.Values = output.StructuredValues
+	chart.ValuesSchema = true
+	chart.ValueAliases = map[string]string{
+		"deployment.myapp.template.containers.myapp": "app",
+	}
+	id := resid.FromRNode(resources[devA])
+
+	if err := chart.Add(id, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	gotFs := filesys.MakeFsInMemory()
+	if err := chart.Store(gotFs, "."); err != nil {
+		t.Fatal(err)
+	}
+
+	got := e2e.ReadFiles(t, gotFs, ".")
+	want := e2e.ReadFsFiles(t, chartStructuredFs, "testdata/chart-structured")
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("chart mismatch, +got -want:\n%s", diff)
+	}
+
+	gotInstance := chart.Instance(prodA)
+	wantInstance := meta
+	wantInstance.ValuesInline = map[string]any{
+		"presets": []string{"prod", "prod_test"},
+		"deployment": map[string]any{
+			"myapp": map[string]any{"replicas": 3.0},
+		},
+	}
+
+	if diff := cmp.Diff(wantInstance, gotInstance); diff != "" {
+		t.Errorf("instance mismatch, +got -want:\n%s", diff)
+	}
+}
+
+func TestChartReservedValueNames(t *testing.T) {
+	for _, name := range []string{"clusterName", "enabled", "presets", "preset_values"} {
+		t.Run(name, func(t *testing.T) {
+			clusters := types.NewClusterIndex()
+			devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+			prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+			prodB := clusters.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod"}})
+			resources := map[types.ClusterID]*yaml.RNode{
+				devA:  yaml.MustParse(appDevA),
+				prodA: yaml.MustParse(appProdA),
+				prodB: yaml.MustParse(appProdB),
+			}
+
+			chart := output.NewChart(types.HelmChart{Name: "myapp", Version: "v0.1"}, clusters)
+			chart.Values = output.StructuredValues
+			chart.ValueAliases = output.ValueAliases{"deployment.myapp.replicas": name}
+
+			if err := chart.Add(resid.FromRNode(resources[devA]), resources); err != nil {
+				t.Fatal(err)
+			}
+
+			got := chart.Instance(prodA).ValuesInline
+			if _, found := got[name+"2"]; !found {
+				t.Errorf("%s is not renamed: %v", name, got)
+			}
+		})
+	}
+}
+
+func TestValueAliasesUnmarshal(t *testing.T) {
+	tests := map[string]bool{
+		`{deployment.myapp: app}`:         true,
+		`{deployment.myapp: app.main_2}`:  true,
+		`{deployment.myapp: ""}`:          false,
+		`{deployment.myapp: app-main}`:    false,
+		`{deployment.myapp: app..main}`:   false,
+		`{deployment.myapp: 2app}`:        false,
+		`{deployment.myapp: [app, main]}`: false,
+	}
+
+	for input, valid := range tests {
+		var aliases output.ValueAliases
+
+		err := yaml.Unmarshal([]byte(input), &aliases)
+		if valid && err != nil {
+			t.Errorf("%s: want no err, got: %v", input, err)
+		}
+
+		if !valid && err == nil {
+			t.Errorf("%s: want err, got none", input)
+		}
+	}
+}
+
+func TestChartSchemaRequired(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	prodB := clusters.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod"}})
+	resources := map[types.ClusterID]*yaml.RNode{
+		devA:  yaml.MustParse(appDevA),
+		prodA: yaml.MustParse(appProdA),
+		prodB: yaml.MustParse(appProdB),
+	}
+
+	chart := output.NewChart(types.HelmChart{Name: "myapp", Version: "v0.1"}, clusters)
+	chart.ValuesSchema = true
+	chart.ExternalPresets = true
+
+	if err := chart.Add(resid.FromRNode(resources[devA]), resources); err != nil {
+		t.Fatal(err)
+	}
+
+	fileSys := filesys.MakeFsInMemory()
+	if err := chart.Store(fileSys, "."); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := fileSys.ReadFile("values.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Properties struct {
+			Global struct {
+				AllOf []struct {
+					Required []string `json:"required"`
+				} `json:"allOf"`
+			} `json:"global"`
+		} `json:"properties"`
+	}
+
+	if err := json.Unmarshal(body, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	// replicas are optional, they are only set for the prod clusters
+	got := [][]string{}
+	for _, item := range schema.Properties.Global.AllOf {
+		got = append(got, item.Required)
+	}
+
+	want := [][]string{
+		nil,
+		{
+			"myapp/Deployment/myapp.metadata.labels.env",
+			"myapp/Deployment/myapp.spec.template.spec.containers.[name=myapp].image",
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("required values mismatch, +got -want:\n%s", diff)
+	}
+}
+
+func TestChartOutputHelmfile(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	prodB := clusters.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod"}})
+	byCluster := map[types.ClusterID]*yaml.RNode{
+		devA:  yaml.MustParse(appDevA),
+		prodA: yaml.MustParse(appProdA),
+		prodB: yaml.MustParse(appProdB),
+	}
+	resources := &types.ClusterResources{
+		Clusters: clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{
+			resid.FromRNode(byCluster[devA]): byCluster,
+		},
+	}
+
+	fileSys := filesys.MakeFsInMemory()
+	out := &output.ChartOutput{
+		HelmChart:    types.HelmChart{Name: "myapp", Version: "v0.1", Namespace: "myapp"},
+		OverlayStyle: output.HelmfileOverlays,
+	}
+
+	if err := out.Store(&types.Env{FileSys: fileSys}, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	got := e2e.ReadFiles(t, fileSys, "/")
+	want := map[string]string{
+		"charts/myapp/values.yaml": "global: {}\n",
+		"values/dev.yaml": "global:\n" +
+			"  myapp/Deployment/myapp.metadata.labels.env: dev\n" +
+			"  myapp/Deployment/myapp.spec.template.spec.containers.[name=myapp].args: enabled\n" +
+			"  myapp/Deployment/myapp.spec.template.spec.containers.[name=myapp].image: myapp:v1.2-345\n",
+		"values/prod.yaml": "global:\n" +
+			"  myapp/Deployment/myapp.metadata.labels.env: prod\n" +
+			"  myapp/Deployment/myapp.spec.template.spec.containers.[name=myapp].image: myapp:v1.1\n",
+		"values/dev-a.yaml":  "global: {}\n",
+		"values/prod-a.yaml": "global:\n  myapp/Deployment/myapp.spec.replicas: 3\n",
+		"values/prod-b.yaml": "global:\n  myapp/Deployment/myapp.spec.replicas: 5\n",
+		"helmfile.yaml": `releases:
+- name: myapp
+  namespace: myapp
+  chart: ./charts/myapp
+  kubeContext: dev-a
+  labels:
+    cluster: dev-a
+  values:
+  - values/dev.yaml
+  - values/dev-a.yaml
+- name: myapp
+  namespace: myapp
+  chart: ./charts/myapp
+  kubeContext: prod-a
+  labels:
+    cluster: prod-a
+  values:
+  - values/prod.yaml
+  - values/prod-a.yaml
+- name: myapp
+  namespace: myapp
+  chart: ./charts/myapp
+  kubeContext: prod-b
+  labels:
+    cluster: prod-b
+  values:
+  - values/prod.yaml
+  - values/prod-b.yaml
+`,
+	}
+
+	for path := range got {
+		if _, found := want[path]; !found {
+			delete(got, path)
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("values files mismatch, +got -want:\n%s", diff)
+	}
+}
+
+const appEnvTemplate = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: app
+spec:
+  selector:
+    matchLabels:
+      app: app
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      containers:
+      - name: app
+        image: app:v1
+        ports:
+        - containerPort: 80
+        env:
+        - name: A
+          value: %s
+        - name: B
+          value: %s
+%s`
+
+func TestChartCollapse(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	resources := map[types.ClusterID]*yaml.RNode{
+		devA:  yaml.MustParse(fmt.Sprintf(appEnvTemplate, "a-dev", "b-dev", "        - name: DEBUG\n          value: \"1\"\n")),
+		prodA: yaml.MustParse(fmt.Sprintf(appEnvTemplate, "a-prod", "b-prod", "")),
+	}
+
+	chart := output.NewChart(types.HelmChart{Name: "app", Version: "v0.1"}, clusters)
+	chart.CollapseThreshold = 0.5
+
+	if err := chart.Add(resid.FromRNode(resources[devA]), resources); err != nil {
+		t.Fatal(err)
+	}
+
+	fileSys := filesys.MakeFsInMemory()
+	if err := chart.Store(fileSys, "."); err != nil {
+		t.Fatal(err)
+	}
+
+	got := e2e.ReadFiles(t, fileSys, ".")
+	want := map[string]string{
+		"templates/app-deployment.yaml": `{{- include "merge_presets" . -}}
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: app
+spec:
+  selector:
+    matchLabels:
+      app: app
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      containers:
+      - name: app
+        image: app:v1
+        ports:
+        - containerPort: 80
+        env: {{- toYaml (index .Values.global "app/Deployment/app.spec.template.spec.containers.[name=app].env") | nindent 8 }}
+`,
+		"values.yaml": `global: {}
+preset_values:
+  dev:
+    app/Deployment/app.spec.template.spec.containers.[name=app].env:
+    - name: A
+      value: a-dev
+    - name: B
+      value: b-dev
+    - name: DEBUG
+      value: "1"
+  prod:
+    app/Deployment/app.spec.template.spec.containers.[name=app].env:
+    - name: A
+      value: a-prod
+    - name: B
+      value: b-prod
+`,
+	}
+
+	for path := range got {
+		if _, found := want[path]; !found {
+			delete(got, path)
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("chart mismatch, +got -want:\n%s", diff)
+	}
+}
+
+const configTemplate = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: app
+  labels: {app: app, port: "%s"}
+data:
+  script: |
+    %s
+    exit 0
+`
+
+func TestChartTemplateValues(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	resources := map[types.ClusterID]*yaml.RNode{
+		devA:  yaml.MustParse(fmt.Sprintf(configTemplate, "8080", "set -x")),
+		prodA: yaml.MustParse(fmt.Sprintf(configTemplate, "80", "set -e")),
+	}
+	id := resid.FromRNode(resources[devA])
+	cres := &types.ClusterResources{
+		Clusters:  clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{id: resources},
+	}
+	env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+	out := &output.ChartOutput{HelmChart: types.HelmChart{Name: "app", Version: "v0.1"}}
+
+	if err := out.Store(env, cres); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := env.FileSys.ReadFile("charts/app/templates/config-configmap.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{{- include "merge_presets" . -}}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: app
+  labels:
+    app: app
+    port: {{ index .Values.global "app/ConfigMap/config.metadata.labels.port" | quote }}
+data:
+  script: {{ index .Values.global "app/ConfigMap/config.data.script" | quote }}
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("template mismatch, +got -want:\n%s", diff)
+	}
+
+	if err := output.Verify(env, out, cres); err != nil {
+		t.Error(err)
+	}
+}
+
+const itemsTemplate = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: app
+spec:
+  template:
+    spec:
+      containers:
+      - %s
+        name: app
+        image: app:v1
+`
+
+func TestChartTemplateListItems(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	resources := map[types.ClusterID]*yaml.RNode{
+		devA:  yaml.MustParse(fmt.Sprintf(itemsTemplate, "# debug build\n        args: [--debug]")),
+		prodA: yaml.MustParse(fmt.Sprintf(itemsTemplate, "# release build")),
+	}
+	id := resid.FromRNode(resources[devA])
+	cres := &types.ClusterResources{
+		Clusters:  clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{id: resources},
+	}
+	env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+	out := &output.ChartOutput{HelmChart: types.HelmChart{Name: "app", Version: "v0.1"}}
+
+	if err := out.Store(env, cres); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := env.FileSys.ReadFile("charts/app/templates/app-deployment.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the item starts with a condition, the "-" precedes it on its own line
+	want := `{{- include "merge_presets" . -}}
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: app
+spec:
+  template:
+    spec:
+      containers:
+      -
+        {{- if index .Values.global "app/Deployment/app.spec.template.spec.containers.[name=app].args" }}
+        args: [--debug]
+        {{- end }}{{/* app/Deployment/app.spec.template.spec.containers.[name=app].args */}}
+        name: app
+        image: app:v1
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("template mismatch, +got -want:\n%s", diff)
+	}
+
+	if err := output.Verify(env, out, cres); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChartCommonMetadata(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	labels := "    app.kubernetes.io/name: shop\n    app.kubernetes.io/part-of: shop\n" +
+		"    app.kubernetes.io/instance: shop-release\n    example.com/cluster: shop-%s\n"
+	resourceTemplate := "apiVersion: v1\nkind: %s\nmetadata:\n  name: shop\n  namespace: shop\n  labels:\n%s"
+	cres := &types.ClusterResources{
+		Clusters:  clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{},
+	}
+
+	for _, byCluster := range []map[types.ClusterID]*yaml.RNode{
+		{
+			devA:  yaml.MustParse(fmt.Sprintf(resourceTemplate, "Service", fmt.Sprintf(labels, "dev-a")+"    env: dev\n")),
+			prodA: yaml.MustParse(fmt.Sprintf(resourceTemplate, "Service", fmt.Sprintf(labels, "prod-a")+"    env: prod\n")),
+		},
+		{
+			devA:  yaml.MustParse(fmt.Sprintf(resourceTemplate, "ServiceAccount", fmt.Sprintf(labels, "dev-a"))),
+			prodA: yaml.MustParse(fmt.Sprintf(resourceTemplate, "ServiceAccount", fmt.Sprintf(labels, "prod-a"))),
+		},
+		{
+			devA:  yaml.MustParse(fmt.Sprintf(resourceTemplate, "ConfigMap", "    app.kubernetes.io/name: shop\n")),
+			prodA: yaml.MustParse(fmt.Sprintf(resourceTemplate, "ConfigMap", "    app.kubernetes.io/name: shop\n")),
+		},
+	} {
+		cres.Resources[resid.FromRNode(byCluster[devA])] = byCluster
+	}
+
+	env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+	out := &output.ChartOutput{
+		HelmChart:      types.HelmChart{Name: "shop", Version: "v0.1", ReleaseName: "shop-release"},
+		CommonMetadata: true,
+	}
+
+	if err := out.Store(env, cres); err != nil {
+		t.Fatal(err)
+	}
+
+	got := e2e.ReadFiles(t, env.FileSys, ".")
+	want := map[string]string{
+		"charts/shop/templates/shop-configmap.yaml": `{{- include "merge_presets" . -}}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shop
+  namespace: shop
+  labels:
+    app.kubernetes.io/name: shop
+`,
+		"charts/shop/templates/shop-service.yaml": `{{- include "merge_presets" . -}}
+apiVersion: v1
+kind: Service
+metadata:
+  name: shop
+  namespace: shop
+  labels:
+    {{- include "shop.labels" . | nindent 4 }}
+    env: {{ index .Values.global "shop/Service/shop.metadata.labels.env" | quote }}
+`,
+		"charts/shop/templates/shop-serviceaccount.yaml": `{{- include "merge_presets" . -}}
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: shop
+  namespace: shop
+  labels:
+    {{- include "shop.labels" . | nindent 4 }}
+`,
+	}
+	helpers := got["charts/shop/templates/_helpers.tpl"]
+
+	for path := range got {
+		if _, found := want[path]; !found {
+			delete(got, path)
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("templates mismatch, +got -want:\n%s", diff)
+	}
+
+	wantHelpers := `{{- define "shop.labels" -}}
+app.kubernetes.io/instance: {{ .Release.Name | quote }}
+app.kubernetes.io/name: shop
+app.kubernetes.io/part-of: shop
+example.com/cluster: {{ print "shop-" (index .Values.global "clusterName") "" | quote }}
+{{- end -}}
+`
+	if !strings.HasSuffix(helpers, wantHelpers) {
+		t.Errorf("unexpected helpers:\n%s", helpers)
+	}
+
+	if err := output.Verify(env, out, cres); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChartUpdate(t *testing.T) {
+	resources := verifyResources()
+	env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+	out := &output.ChartOutput{
+		HelmChart: types.HelmChart{Name: "myapp", Version: "v0.1"},
+		Update:    true,
+	}
+
+	if err := out.Store(env, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	edit := func(path, old, replacement string) {
+		t.Helper()
+
+		body, err := env.FileSys.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := env.FileSys.WriteFile(path, []byte(strings.Replace(string(body), old, replacement, 1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	templatePath := "charts/myapp/templates/myapp-deployment.yaml"
+	edit(templatePath, "spec:\n", "spec:\n  revisionHistoryLimit: 3\n")
+	edit("charts/myapp/Chart.yaml", "name: myapp\n", "name: myapp\ndescription: My app\n")
+	edit("charts/myapp/values.yaml", "global: {}\n", "global: {}\nextra: value\n")
+
+	for _, byCluster := range resources.Resources {
+		for clusterID, cluster := range resources.Clusters.All() {
+			if cluster.Name != "prod-b" {
+				continue
+			}
+
+			err := byCluster[clusterID].PipeE(yaml.Lookup("spec"), yaml.SetField("replicas", yaml.NewScalarRNode("3")))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for range 2 {
+		if err := out.Store(env, resources); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := e2e.ReadFiles(t, env.FileSys, ".")
+	want := map[string]string{
+		"charts/myapp/Chart.yaml": "apiVersion: v2\nname: myapp\ndescription: My app\nversion: v0.1.1\n",
+		"charts/myapp/values.yaml": `global: {}
+extra: value
+preset_values:
+  dev:
+    myapp/Deployment/myapp.metadata.labels.env: dev
+    myapp/Deployment/myapp.spec.template.spec.containers.[name=myapp].args: enabled
+    myapp/Deployment/myapp.spec.template.spec.containers.[name=myapp].image: myapp:v1.2-345
+  prod:
+    myapp/Deployment/myapp.metadata.labels.env: prod
+    myapp/Deployment/myapp.spec.replicas: enabled
+  prod_test:
+    myapp/Deployment/myapp.spec.template.spec.containers.[name=myapp].image: myapp:v1.1
+  test:
+    myapp/Deployment/myapp.metadata.labels.env: test
+`,
+		"overlays/prod-b/kustomization.yaml": `kind: Kustomization
+helmGlobals:
+  chartHome: ../../charts
+helmCharts:
+- name: myapp
+  version: v0.1.1
+  valuesInline:
+    presets:
+    - prod
+    - prod_test
+`,
+	}
+
+	if !strings.Contains(got[templatePath], "revisionHistoryLimit: 3") {
+		t.Errorf("edited template is overwritten:\n%s", got[templatePath])
+	}
+
+	for path := range got {
+		if _, found := want[path]; !found {
+			delete(got, path)
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("chart mismatch, +got -want:\n%s", diff)
+	}
+}
+
+func TestChartUpdateMigrate(t *testing.T) {
+	resources := verifyResources()
+	env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+	out := &output.ChartOutput{HelmChart: types.HelmChart{Name: "myapp", Version: "v0.1"}}
+	templatePath := "charts/myapp/templates/myapp-deployment.yaml"
+	edit := func(old, replacement string) {
+		t.Helper()
+
+		body, err := env.FileSys.ReadFile(templatePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := env.FileSys.WriteFile(templatePath, []byte(strings.Replace(string(body), old, replacement, 1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the chart generated without the hashes is regenerated
+	if err := out.Store(env, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	edit("spec:\n", "spec:\n  revisionHistoryLimit: 3\n")
+
+	out.Update = true
+	if err := out.Store(env, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	got := e2e.ReadFiles(t, env.FileSys, ".")
+	if strings.Contains(got[templatePath], "revisionHistoryLimit") {
+		t.Errorf("template of the old chart is not regenerated:\n%s", got[templatePath])
+	}
+
+	if want := ".ktl-generated.yaml\n"; got["charts/myapp/.helmignore"] != want {
+		t.Errorf("unexpected .helmignore: %q", got["charts/myapp/.helmignore"])
+	}
+
+	// the values of the edited template are kept
+	edit("spec:\n", "spec:\n  revisionHistoryLimit: 3\n")
+
+	for _, byCluster := range resources.Resources {
+		for _, node := range byCluster {
+			if err := node.PipeE(yaml.Lookup("metadata", "labels"), yaml.SetField("env", yaml.NewStringRNode("any"))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := out.Store(env, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	got = e2e.ReadFiles(t, env.FileSys, ".")
+	want := `global: {}
+preset_values:
+  dev:
+    myapp/Deployment/myapp.spec.template.spec.containers.[name=myapp].args: enabled
+    myapp/Deployment/myapp.spec.template.spec.containers.[name=myapp].image: myapp:v1.2-345
+    myapp/Deployment/myapp.metadata.labels.env: dev
+  prod_test:
+    myapp/Deployment/myapp.spec.template.spec.containers.[name=myapp].image: myapp:v1.1
+`
+
+	if diff := cmp.Diff(want, got["charts/myapp/values.yaml"]); diff != "" {
+		t.Errorf("values mismatch, +got -want:\n%s", diff)
+	}
+
+	if !strings.Contains(got[templatePath], "revisionHistoryLimit: 3") {
+		t.Errorf("edited template is overwritten:\n%s", got[templatePath])
+	}
+}
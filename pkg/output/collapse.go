@@ -0,0 +1,85 @@
+package output
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Mirantis/ktl/pkg/resource"
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/openapi"
+	"sigs.k8s.io/kustomize/kyaml/sets"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+type pathStats struct {
+	path     resource.Query
+	clusters int
+	variants int
+}
+
+func isSubpath(parent, child resource.Query) bool {
+	return len(child) > len(parent) && slices.Equal(parent, child[:len(parent)])
+}
+
+// collapsedPaths returns the outermost mapping fields, where the share of the
+// leaves varying between the clusters or missing in some of them reaches the
+// threshold.
+//
+//nolint:lll
+func collapsedPaths(resources map[types.ClusterID]*yaml.RNode, schema *openapi.ResourceSchema, threshold float64) (sets.String, error) {
+	collapsed := sets.String{}
+	if threshold <= 0 {
+		return collapsed, nil
+	}
+
+	stats := []pathStats{}
+	resIterator := resource.NewIterator(resources, schema)
+
+	for resIterator.Next() {
+		stats = append(stats, pathStats{
+			path:     resIterator.Path(),
+			clusters: len(resIterator.Clusters()),
+			variants: len(resource.GroupByValue(resIterator.Values())),
+		})
+	}
+
+	if err := resIterator.Error(); err != nil {
+		return nil, fmt.Errorf("unable to collect variants: %w", err)
+	}
+
+	roots := []resource.Query{}
+	isLeaf := func(idx int) bool {
+		return idx+1 == len(stats) || !isSubpath(stats[idx].path, stats[idx+1].path)
+	}
+
+	for idx, root := range stats {
+		if len(root.path) == 0 || yaml.IsListIndex(root.path[len(root.path)-1]) || isLeaf(idx) {
+			continue
+		}
+
+		if slices.ContainsFunc(roots, func(path resource.Query) bool { return isSubpath(path, root.path) }) {
+			continue
+		}
+
+		leaves, varying := 0, 0
+
+		for child := idx + 1; child < len(stats) && isSubpath(root.path, stats[child].path); child++ {
+			if !isLeaf(child) {
+				continue
+			}
+
+			leaves++
+
+			if stats[child].variants > 1 || stats[child].clusters < root.clusters {
+				varying++
+			}
+		}
+
+		if varying > 0 && float64(varying) >= threshold*float64(leaves) {
+			roots = append(roots, root.path)
+			collapsed.Insert(root.path.String())
+		}
+	}
+
+	return collapsed, nil
+}
@@ -3,6 +3,8 @@ package output
 import (
 	"errors"
 	"fmt"
+	"iter"
+	"log/slog"
 	"maps"
 	"path/filepath"
 	"slices"
@@ -15,28 +17,45 @@ import (
 	"sigs.k8s.io/kustomize/kyaml/filesys"
 	"sigs.k8s.io/kustomize/kyaml/openapi"
 	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/sets"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
-type ComponentsOutput struct{}
+type ComponentsOutput struct {
+	Layout  ComponentsLayout `yaml:"layout"`
+	Patches PatchFormat      `yaml:"patches"`
+	Paths   Paths            `yaml:"paths"`
+	Base    bool             `yaml:"base"`
+}
 
 //nolint:lll
-func (out *ComponentsOutput) storeComponentsOverlays(env *types.Env, resources *types.ClusterResources, comps *Components, compsDir string) error {
+func (out *ComponentsOutput) storeComponentsOverlays(env *types.Env, resources *types.ClusterResources, comps *Components) error {
+	paths := out.Paths.withDefaults()
+
 	for clusterID, cluster := range resources.Clusters.All() {
-		overlayDir := filepath.Join("overlays", cluster.Name)
+		overlayDir := paths.Overlays.Expand(types.PathVars{Cluster: &cluster})
 		fileStore := resource.FileStore{
 			FileSystem: fsutil.Sub(env.FileSys, overlayDir),
 		}
 		kust := &types.Kustomization{}
 		kust.Kind = types.KustomizationKind
 
+		if base := comps.Base(); base != "" {
+			relPath, err := filepath.Rel(overlayDir, comps.Path(base))
+			if err != nil {
+				panic(err)
+			}
+
+			kust.Resources = append(kust.Resources, relPath)
+		}
+
 		compNames, err := comps.Cluster(clusterID)
 		if err != nil {
 			panic(err)
 		}
 
 		for _, compName := range compNames {
-			relPath, err := filepath.Rel(overlayDir, filepath.Join(compsDir, compName))
+			relPath, err := filepath.Rel(overlayDir, comps.Path(compName))
 			if err != nil {
 				panic(err)
 			}
@@ -53,21 +72,42 @@ func (out *ComponentsOutput) storeComponentsOverlays(env *types.Env, resources *
 }
 
 func (out *ComponentsOutput) Store(env *types.Env, resources *types.ClusterResources) error {
-	const compsDir = "components"
+	paths := out.Paths.withDefaults()
+	if err := checkOverlayPaths(paths.Overlays, resources.Clusters); err != nil {
+		return err
+	}
+
 	comps := NewComponents(resources.Clusters)
-	compsFS := fsutil.Sub(env.FileSys, compsDir)
+	comps.Layout = out.Layout
+	comps.PatchFormat = out.Patches
+	comps.PathTemplate = paths.Components
+	comps.FileTemplate = paths.Resources
+
+	if out.Base {
+		comps.BasePath = paths.Base
+	}
 
-	for id, byCluster := range resources.Resources {
-		if err := comps.Add(id, byCluster); err != nil {
+	for _, id := range resources.IDs() {
+		if err := comps.Add(id, resources.Resources[id]); err != nil {
 			return fmt.Errorf("unable to add resources to the component: %w", err)
 		}
 	}
 
-	if err := comps.Store(compsFS); err != nil {
+	cost, greedyCost := comps.Cost(), comps.GreedyCost()
+	slog.Info(
+		"components layout",
+		"layout", comps.Layout,
+		"components", cost.Components,
+		"values", cost.Values,
+		"cost", cost.Total(),
+		"greedyCost", greedyCost.Total(),
+	)
+
+	if err := comps.Store(env.FileSys); err != nil {
 		return fmt.Errorf("unable to store components: %w", err)
 	}
 
-	return out.storeComponentsOverlays(env, resources, comps, compsDir)
+	return out.storeComponentsOverlays(env, resources, comps)
 }
 
 type component struct {
@@ -77,12 +117,21 @@ type component struct {
 	clusters  []types.ClusterID
 }
 
-func (comp *component) store(fileSys filesys.FileSystem) error {
+var errPathConflict = errors.New("resource and patch stored in the same file")
+
+//nolint:lll
+func (comp *component) store(fileSys filesys.FileSystem, kind string, nameGenerator func(resid.ResId) string, patchNodes map[resid.ResId]*yaml.RNode, format PatchFormat) error {
 	kust := &types.Kustomization{}
-	kust.Kind = types.ComponentKind
+	kust.Kind = kind
+	resourcePaths := sets.String{}
 	resourceStore := &resource.FileStore{
-		FileSystem:    fileSys,
-		NameGenerator: resource.FileName,
+		FileSystem: fileSys,
+		NameGenerator: func(resID resid.ResId) string {
+			path := nameGenerator(resID)
+			resourcePaths.Insert(path)
+
+			return path
+		},
 		PostProcessor: func(path string, body []byte) []byte {
 			kust.Resources = append(kust.Resources, path)
 
@@ -95,9 +144,20 @@ func (comp *component) store(fileSys filesys.FileSystem) error {
 	}
 
 	patches := []string{}
+	patchTargets := map[string][]resid.ResId{}
+
+	for resID := range patchNodes {
+		path := nameGenerator(resID)
+		if resourcePaths.Has(path) {
+			return fmt.Errorf("%w: %s", errPathConflict, path)
+		}
+
+		patchTargets[path] = append(patchTargets[path], resID)
+	}
+
 	patchStore := &resource.FileStore{
 		FileSystem:    fileSys,
-		NameGenerator: resource.FileName,
+		NameGenerator: nameGenerator,
 		PostProcessor: func(path string, body []byte) []byte {
 			patches = append(patches, path)
 
@@ -105,15 +165,29 @@ func (comp *component) store(fileSys filesys.FileSystem) error {
 		},
 	}
 
-	if err := patchStore.WriteAll(maps.All(comp.patches)); err != nil {
+	if err := patchStore.WriteAll(maps.All(patchNodes)); err != nil {
 		return fmt.Errorf("unable to store component files: %w", err)
 	}
 
 	slices.Sort(kust.Resources)
 	slices.Sort(patches)
 
-	for _, patch := range patches {
-		kust.Patches = append(kust.Patches, types.Patch{Path: patch})
+	for _, path := range patches {
+		patch := types.Patch{Path: path}
+
+		// json patches are lists, strategic-merge patches need no target
+		targets := patchTargets[path]
+		if format == JSON6902Patch && slices.ContainsFunc(targets, func(resID resid.ResId) bool {
+			return patchNodes[resID].YNode().Kind == yaml.SequenceNode
+		}) {
+			if len(targets) != 1 {
+				return fmt.Errorf("%w: %s", errJSONPatchTarget, path)
+			}
+
+			patch.Target = &types.Selector{ResId: targets[0]}
+		}
+
+		kust.Patches = append(kust.Patches, patch)
 	}
 
 	if err := resourceStore.WriteKustomization(kust); err != nil {
@@ -124,16 +198,33 @@ func (comp *component) store(fileSys filesys.FileSystem) error {
 }
 
 type Components struct {
+	Layout      ComponentsLayout
+	PatchFormat PatchFormat
+	// PathTemplate defines component directories, relative to the file
+	// system passed to Store, "${GROUP}" by default.
+	PathTemplate types.PathTemplate
+	// FileTemplate defines resource file names, relative to the component
+	// directory.
+	FileTemplate types.PathTemplate
+	// BasePath, if set, stores the group of all clusters as a kustomize
+	// base instead of a component.
+	BasePath types.PathTemplate
+
 	clusters  *types.ClusterIndex
 	byName    map[string]*component
 	byCluster map[types.ClusterID][]*component
+
+	values       int
+	greedyValues int
+	greedyGroups sets.String
 }
 
 func NewComponents(clusters *types.ClusterIndex) *Components {
 	comps := &Components{
-		clusters:  clusters,
-		byName:    map[string]*component{},
-		byCluster: map[types.ClusterID][]*component{},
+		clusters:     clusters,
+		byName:       map[string]*component{},
+		byCluster:    map[types.ClusterID][]*component{},
+		greedyGroups: sets.String{},
 	}
 
 	return comps
@@ -150,14 +241,33 @@ func (comps *Components) Cluster(cluster types.ClusterID) ([]string, error) {
 	}
 
 	sort.Sort(componentsOrder(items))
+	base := comps.Base()
 
 	for _, item := range items {
+		if item.name == base {
+			continue
+		}
+
 		names = append(names, item.name)
 	}
 
 	return names, nil
 }
 
+// Base returns the name of the group stored as a kustomize base, if any.
+func (comps *Components) Base() string {
+	if comps.BasePath == "" {
+		return ""
+	}
+
+	name := comps.clusters.Group(comps.clusters.IDs()...)
+	if _, found := comps.byName[name]; !found {
+		return ""
+	}
+
+	return name
+}
+
 func (comps *Components) component(ids ...types.ClusterID) *component {
 	name := comps.clusters.Group(ids...)
 
@@ -180,34 +290,49 @@ func (comps *Components) component(ids ...types.ClusterID) *component {
 }
 
 func (comps *Components) Add(resID resid.ResId, resources map[types.ClusterID]*yaml.RNode) error {
-	mainBuilder := resource.NewBuilder(resID)
-	mainClusterIDs := slices.Collect(maps.Keys(resources))
+	mainBuilder := newPatchBuilder(resID)
+	mainClusterIDs := slices.Sorted(maps.Keys(resources))
 	mainComp := comps.component(mainClusterIDs...)
 	mainComp.resources[resID] = mainBuilder.RNode()
-	builders := map[string]*resource.Builder{}
+	builders := map[string]*patchBuilder{mainComp.name: mainBuilder}
 	schema := openapi.SchemaForResourceType(resID.AsTypeMeta())
 
+	coverage := map[string][]types.ClusterID{"": mainClusterIDs}
+	containers := map[string]*yaml.Node{}
+	mergeKeys := map[string][]string{}
+
 	resIter := resource.NewIterator(resources, schema)
 	for resIter.Next() {
-		variants := resource.GroupByValue(resIter.Values())
-		for _, variant := range variants {
-			comp := mainComp
-			builder := mainBuilder
-
-			if len(variant.Clusters) != len(mainClusterIDs) {
-				comp = comps.component(variant.Clusters...)
-				builder = builders[comp.name]
-			}
+		path := resIter.Path()
+		variants := placedVariants(resIter)
+		comps.addGreedyCost(variants)
+
+		parentIDs := mainClusterIDs
+		if len(path) > 0 {
+			coverage[path.String()] = resIter.Clusters()
+			parentIDs = coverage[path[:len(path)-1].String()]
+		}
+
+		if !resIter.IsValue() {
+			_, mergeKeys[path.String()] = resIter.Schema().PatchStrategyAndKeyList()
+			containers[path.String()] = containerNode(resIter, mergeKeys)
+		}
+
+		for _, place := range comps.placements(path, parentIDs, variants, resIter.IsValue()) {
+			comp := comps.component(place.clusters...)
+			builder := builders[comp.name]
 
 			if builder == nil {
-				builder = resource.NewBuilder(resID)
+				builder = newPatchBuilder(resID)
 				comp.patches[resID] = builder.RNode()
 				builders[comp.name] = builder
 			}
 
-			if _, err := builder.Set(resIter.Path(), variant.Value); err != nil {
-				return fmt.Errorf("unable to set %s for %s: %w", resIter.Path(), resID, err)
+			if err := builder.set(path, place.value, containers); err != nil {
+				return fmt.Errorf("unable to set %s for %s: %w", path, resID, err)
 			}
+
+			comps.values++
 		}
 	}
 
@@ -218,9 +343,179 @@ func (comps *Components) Add(resID resid.ResId, resources map[types.ClusterID]*y
 	return nil
 }
 
+// patchBuilder builds a resource or a patch of a component, the containers
+// are created only along with the values placed in them.
+type patchBuilder struct {
+	*resource.Builder
+
+	created sets.String
+}
+
+func newPatchBuilder(resID resid.ResId) *patchBuilder {
+	return &patchBuilder{Builder: resource.NewBuilder(resID), created: sets.String{}}
+}
+
+func (b *patchBuilder) set(path resource.Query, value *yaml.Node, containers map[string]*yaml.Node) error {
+	for idx := 1; idx < len(path); idx++ {
+		parent := path[:idx].String()
+		if b.created.Has(parent) {
+			continue
+		}
+
+		// the metadata is created along with the builder
+		node := containers[parent]
+		if len(node.Content) == 0 {
+			if _, err := b.Add(path[:idx], node.Kind); err != nil {
+				return err //nolint:wrapcheck
+			}
+		} else if _, err := b.Set(path[:idx], yaml.CopyYNode(node)); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		b.created.Insert(parent)
+	}
+
+	if _, found := containers[path.String()]; found {
+		b.created.Insert(path.String())
+	}
+
+	_, err := b.Set(path, value)
+
+	return err //nolint:wrapcheck
+}
+
+// containerNode returns the node created for the current mapping or
+// associative list, the list elements are created with their merge keys.
+func containerNode(resIter *resource.Iterator, mergeKeys map[string][]string) *yaml.Node {
+	path := resIter.Path()
+	result := &yaml.Node{}
+
+	for _, node := range resIter.Nodes() {
+		result.Kind = node.Kind
+
+		if len(path) == 0 || !yaml.IsListIndex(path[len(path)-1]) {
+			break
+		}
+
+		keys := mergeKeys[path[:len(path)-1].String()]
+
+		for idx := 0; idx < len(node.Content); idx += 2 {
+			if slices.Contains(keys, node.Content[idx].Value) {
+				result.Content = append(result.Content, yaml.CopyYNode(node.Content[idx]), yaml.CopyYNode(node.Content[idx+1]))
+			}
+		}
+
+		break
+	}
+
+	return result
+}
+
+// placedVariants returns the variants placed for the current path. Mappings
+// and associative lists are created along with their children in the same
+// components, only the empty ones are placed as values.
+func placedVariants(resIter *resource.Iterator) []*resource.ValueGroup {
+	if resIter.IsValue() {
+		return resource.GroupByValue(resIter.Values())
+	}
+
+	return resource.GroupByValue(func(yield func(types.ClusterID, *yaml.Node) bool) {
+		for id, node := range resIter.Nodes() {
+			if len(node.Content) == 0 && !yield(id, node) {
+				return
+			}
+		}
+	})
+}
+
+//nolint:lll
+func (comps *Components) placements(path resource.Query, parentIDs []types.ClusterID, variants []*resource.ValueGroup, isValue bool) []placement {
+	// empty containers are never overridden by the children placed in
+	// broader layers, they are placed in the components of their clusters
+	if comps.Layout == LayeredLayout && isValue {
+		// JSON patches can remove fields inherited from a broader layer,
+		// list elements are never removed to keep the list indices stable
+		removable := comps.PatchFormat == JSON6902Patch && len(path) > 0 && !yaml.IsListIndex(path[len(path)-1])
+
+		return comps.layeredPlacements(parentIDs, variants, removable)
+	}
+
+	return greedyPlacements(variants)
+}
+
+func (comps *Components) addGreedyCost(variants []*resource.ValueGroup) {
+	comps.greedyValues += len(variants)
+	for _, variant := range variants {
+		comps.greedyGroups.Insert(comps.clusters.Group(variant.Clusters...))
+	}
+}
+
+// Cost returns the size of the generated components.
+func (comps *Components) Cost() LayoutCost {
+	return LayoutCost{Components: len(comps.byName), Values: comps.values}
+}
+
+// GreedyCost returns the size of the components generated by GreedyLayout
+// for the same input, regardless of the selected layout.
+func (comps *Components) GreedyCost() LayoutCost {
+	return LayoutCost{Components: len(comps.greedyGroups), Values: comps.greedyValues}
+}
+
+func (comps *Components) Path(name string) string {
+	tmpl := comps.PathTemplate
+	if tmpl == "" {
+		tmpl = "${GROUP}"
+	}
+
+	if name == comps.Base() {
+		tmpl = comps.BasePath
+	}
+
+	return tmpl.Expand(types.PathVars{Group: name})
+}
+
+// paths returns the directories of the components by name.
+func (comps *Components) paths() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for _, name := range slices.Sorted(maps.Keys(comps.byName)) {
+			if !yield(name, comps.Path(name)) {
+				return
+			}
+		}
+	}
+}
+
 func (comps *Components) Store(fileSys filesys.FileSystem) error {
+	if err := checkUniquePaths(comps.paths()); err != nil {
+		return err
+	}
+
+	base := comps.Base()
+	patches := map[string]map[resid.ResId]*yaml.RNode{}
+
+	if comps.PatchFormat == JSON6902Patch {
+		var err error
+		if patches, err = comps.jsonPatches(); err != nil {
+			return fmt.Errorf("unable to generate json patches: %w", err)
+		}
+
+		comps.dropEmpty(patches)
+	} else {
+		for name, comp := range comps.byName {
+			patches[name] = comp.patches
+		}
+	}
+
 	for name, comp := range comps.byName {
-		if err := comp.store(fsutil.Sub(fileSys, name)); err != nil {
+		kind := types.ComponentKind
+		if name == base {
+			kind = types.KustomizationKind
+		}
+
+		compFS := fsutil.Sub(fileSys, comps.Path(name))
+		nameGenerator := resource.FileNameTemplate(comps.FileTemplate, types.PathVars{Group: name})
+
+		if err := comp.store(compFS, kind, nameGenerator, patches[name], comps.PatchFormat); err != nil {
 			return fmt.Errorf("unable to store component %s: %w", name, err)
 		}
 	}
@@ -228,6 +523,24 @@ func (comps *Components) Store(fileSys filesys.FileSystem) error {
 	return nil
 }
 
+// dropEmpty removes the components without resources and patches, their
+// clusters get the same resources from the broader components.
+func (comps *Components) dropEmpty(patches map[string]map[resid.ResId]*yaml.RNode) {
+	for name, comp := range comps.byName {
+		if len(comp.resources) > 0 || len(patches[name]) > 0 {
+			continue
+		}
+
+		delete(comps.byName, name)
+
+		for _, id := range comp.clusters {
+			comps.byCluster[id] = slices.DeleteFunc(comps.byCluster[id], func(other *component) bool {
+				return other == comp
+			})
+		}
+	}
+}
+
 type componentsOrder []*component
 
 func (o componentsOrder) Len() int      { return len(o) }
@@ -2,6 +2,7 @@ package output_test
 
 import (
 	"embed"
+	"fmt"
 	"testing"
 
 	"github.com/Mirantis/ktl/pkg/e2e"
@@ -49,3 +50,210 @@ func TestComponents(t *testing.T) {
 		t.Errorf("components mismatch, +got -want:\n%s", diff)
 	}
 }
+
+//go:embed testdata/components-layered
+var compLayeredFs embed.FS
+
+func TestComponentsLayered(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	prodB := clusters.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod"}})
+	testA := clusters.Add(types.Cluster{Name: "test-a", Tags: []string{"test"}})
+	testB := clusters.Add(types.Cluster{Name: "test-b", Tags: []string{"test"}})
+	resources := map[types.ClusterID]*yaml.RNode{
+		devA:  yaml.MustParse(appDevA),
+		prodA: yaml.MustParse(appProdA),
+		prodB: yaml.MustParse(appProdB),
+		testA: yaml.MustParse(appTestA),
+		testB: yaml.MustParse(appTestB),
+	}
+	id := resid.FromRNode(resources[devA])
+
+	comps := output.NewComponents(clusters)
+	comps.Layout = output.LayeredLayout
+
+	if err := comps.Add(id, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	gotFs := filesys.MakeFsInMemory()
+	if err := comps.Store(gotFs); err != nil {
+		t.Fatal(err)
+	}
+
+	got := e2e.ReadFiles(t, gotFs, ".")
+	want := e2e.ReadFsFiles(t, compLayeredFs, "testdata/components-layered")
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("components mismatch, +got -want:\n%s", diff)
+	}
+
+	wantCost := output.LayoutCost{Components: 5, Values: 17}
+	if diff := cmp.Diff(wantCost, comps.Cost()); diff != "" {
+		t.Errorf("cost mismatch, +got -want:\n%s", diff)
+	}
+
+	if comps.Cost().Total() >= comps.GreedyCost().Total() {
+		t.Errorf("layered cost %v is not lower than greedy cost %v", comps.Cost(), comps.GreedyCost())
+	}
+}
+
+//go:embed testdata/components-json6902
+var compJSONFs embed.FS
+
+func TestComponentsJSON6902(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	prodB := clusters.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod"}})
+	testA := clusters.Add(types.Cluster{Name: "test-a", Tags: []string{"test"}})
+	testB := clusters.Add(types.Cluster{Name: "test-b", Tags: []string{"test"}})
+	resources := map[types.ClusterID]*yaml.RNode{
+		devA:  yaml.MustParse(appDevA),
+		prodA: yaml.MustParse(appProdA),
+		prodB: yaml.MustParse(appProdB),
+		testA: yaml.MustParse(appTestA),
+		testB: yaml.MustParse(appTestB),
+	}
+	id := resid.FromRNode(resources[devA])
+
+	comps := output.NewComponents(clusters)
+	comps.Layout = output.LayeredLayout
+	comps.PatchFormat = output.JSON6902Patch
+
+	if err := comps.Add(id, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	gotFs := filesys.MakeFsInMemory()
+	if err := comps.Store(gotFs); err != nil {
+		t.Fatal(err)
+	}
+
+	got := e2e.ReadFiles(t, gotFs, ".")
+	want := e2e.ReadFsFiles(t, compJSONFs, "testdata/components-json6902")
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("components mismatch, +got -want:\n%s", diff)
+	}
+}
+
+func TestComponentsOutputBase(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	prodB := clusters.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod"}})
+	byCluster := map[types.ClusterID]*yaml.RNode{
+		devA:  yaml.MustParse(appDevA),
+		prodA: yaml.MustParse(appProdA),
+		prodB: yaml.MustParse(appProdB),
+	}
+	resources := &types.ClusterResources{
+		Clusters: clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{
+			resid.FromRNode(byCluster[devA]): byCluster,
+		},
+	}
+
+	fileSys := filesys.MakeFsInMemory()
+	out := &output.ComponentsOutput{Base: true}
+
+	if err := out.Store(&types.Env{FileSys: fileSys}, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	got := e2e.ReadFiles(t, fileSys, "/")
+	want := map[string]string{
+		"base/kustomization.yaml":              "kind: Kustomization\nresources:\n- myapp/myapp-deployment.yaml\n",
+		"components/dev/kustomization.yaml":    "kind: Component\npatches:\n- path: myapp/myapp-deployment.yaml\n",
+		"components/prod-a/kustomization.yaml": "kind: Component\npatches:\n- path: myapp/myapp-deployment.yaml\n",
+		"components/prod-b/kustomization.yaml": "kind: Component\npatches:\n- path: myapp/myapp-deployment.yaml\n",
+		"components/prod/kustomization.yaml":   "kind: Component\npatches:\n- path: myapp/myapp-deployment.yaml\n",
+		"overlays/dev-a/kustomization.yaml":    "kind: Kustomization\nresources:\n- ../../base\ncomponents:\n- ../../components/dev\n",
+		"overlays/prod-a/kustomization.yaml":   "kind: Kustomization\nresources:\n- ../../base\ncomponents:\n- ../../components/prod\n- ../../components/prod-a\n",
+		"overlays/prod-b/kustomization.yaml":   "kind: Kustomization\nresources:\n- ../../base\ncomponents:\n- ../../components/prod\n- ../../components/prod-b\n",
+	}
+
+	for path := range got {
+		if _, found := want[path]; !found {
+			delete(got, path)
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("kustomizations mismatch, +got -want:\n%s", diff)
+	}
+}
+
+func TestComponentsOutputStable(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	ids := []types.ClusterID{
+		clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}}),
+		clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}}),
+		clusters.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod"}}),
+		clusters.Add(types.Cluster{Name: "test-a", Tags: []string{"test"}}),
+		clusters.Add(types.Cluster{Name: "test-b", Tags: []string{"test"}}),
+		clusters.Add(types.Cluster{Name: "prod-c", Tags: []string{"prod", "eu"}}),
+		clusters.Add(types.Cluster{Name: "test-c", Tags: []string{"test", "eu"}}),
+		clusters.Add(types.Cluster{Name: "dev-b", Tags: []string{"dev", "eu"}}),
+	}
+	resources := &types.ClusterResources{
+		Clusters:  clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{},
+	}
+
+	// the resources missing on some clusters ("-") add the components of
+	// their clusters to the layer candidates of the following resources
+	values := [][]string{
+		{"c", "a", "c", "c", "b", "a", "b", "c"},
+		{"-", "c", "a", "b", "a", "c", "-", "c"},
+		{"a", "b", "-", "-", "c", "a", "a", "-"},
+		{"b", "-", "-", "b", "-", "a", "-", "b"},
+		{"-", "b", "-", "-", "b", "c", "c", "-"},
+	}
+
+	for idx, byCluster := range values {
+		for clusterIdx, value := range byCluster {
+			if value == "-" {
+				continue
+			}
+
+			rnode := yaml.MustParse(fmt.Sprintf(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config-%d
+  namespace: myapp
+data:
+  key: %s
+`, idx, value))
+
+			id := resid.FromRNode(rnode)
+			if resources.Resources[id] == nil {
+				resources.Resources[id] = map[types.ClusterID]*yaml.RNode{}
+			}
+
+			resources.Resources[id][ids[clusterIdx]] = rnode
+		}
+	}
+
+	var want map[string]string
+
+	for range 20 {
+		env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+		out := &output.ComponentsOutput{Layout: output.LayeredLayout}
+
+		if err := out.Store(env, resources); err != nil {
+			t.Fatal(err)
+		}
+
+		got := e2e.ReadFiles(t, env.FileSys, ".")
+		if want == nil {
+			want = got
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("components differ between runs, +got -want:\n%s", diff)
+		}
+	}
+}
@@ -7,3 +7,9 @@
 {{-   end -}}
 {{- end -}}
 {{- end -}}
+{{- define "merge_preset_values" -}}
+{{- $values := .Values -}}
+{{- range $idx, $preset := .Values.presets -}}
+{{-   $_ := mergeOverwrite $values (index $values.preset_values $preset) -}}
+{{- end -}}
+{{- end -}}
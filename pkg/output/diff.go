@@ -0,0 +1,243 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Mirantis/ktl/pkg/resource"
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// diffContext is the number of unchanged lines around the unified diff hunks.
+const diffContext = 3
+
+// Variant is the resource as seen by a cluster, or a group of clusters. The
+// node is nil if the resource is missing.
+type Variant struct {
+	Name string
+	Node *yaml.RNode
+}
+
+func (variant Variant) lines() []string {
+	if variant.Node == nil {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(variant.Node.MustString(), "\n"), "\n")
+}
+
+// ClusterVariants returns the resource of every cluster. If grouped, it
+// returns a variant per distinct resource instead, named after the group of
+// its clusters, e.g. "prod".
+func ClusterVariants(resources *types.ClusterResources, id resid.ResId, grouped bool) []Variant {
+	byCluster := resources.Resources[id]
+	variants := []Variant{}
+	missing := []types.ClusterID{}
+
+	for clusterID, cluster := range resources.Clusters.All() {
+		node, found := byCluster[clusterID]
+		if !found {
+			missing = append(missing, clusterID)
+		}
+
+		if !grouped {
+			variants = append(variants, Variant{Name: cluster.Name, Node: node})
+		}
+	}
+
+	if !grouped {
+		return variants
+	}
+
+	values := func(yield func(types.ClusterID, *yaml.Node) bool) {
+		for clusterID, node := range byCluster {
+			if !yield(clusterID, node.YNode()) {
+				return
+			}
+		}
+	}
+
+	for _, group := range resource.GroupByValue(values) {
+		variants = append(variants, Variant{
+			Name: resources.Clusters.Group(group.Clusters...),
+			Node: yaml.NewRNode(group.Value),
+		})
+	}
+
+	if len(missing) > 0 {
+		variants = append(variants, Variant{Name: resources.Clusters.Group(missing...)})
+	}
+
+	return variants
+}
+
+type diffOp byte
+
+const (
+	diffEqual  diffOp = ' '
+	diffDelete diffOp = '-'
+	diffInsert diffOp = '+'
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// diffLines returns the longest common subsequence edit script of the lines.
+func diffLines(from, to []string) []diffLine {
+	common := make([][]int, len(from)+1)
+	for i := range common {
+		common[i] = make([]int, len(to)+1)
+	}
+
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	script := []diffLine{}
+	i, j := 0, 0
+
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			script = append(script, diffLine{diffEqual, from[i]})
+			i++
+			j++
+		case j == len(to) || (i < len(from) && common[i+1][j] >= common[i][j+1]):
+			script = append(script, diffLine{diffDelete, from[i]})
+			i++
+		default:
+			script = append(script, diffLine{diffInsert, to[j]})
+			j++
+		}
+	}
+
+	return script
+}
+
+// hunkRange returns the unified diff range of the lines, the empty range
+// starts at the preceding line.
+func hunkRange(start, end int) string {
+	if start == end {
+		return fmt.Sprintf("%d,0", start)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, end-start)
+}
+
+// UnifiedDiff returns the diff of the resource variants in the unified
+// format, it is empty if the variants are the same.
+func UnifiedDiff(from, to Variant) string {
+	script := diffLines(from.lines(), to.lines())
+	// the number of the lines preceding the script line in both variants
+	fromPos, toPos := make([]int, len(script)+1), make([]int, len(script)+1)
+	changes := []int{}
+
+	for idx, line := range script {
+		fromPos[idx+1], toPos[idx+1] = fromPos[idx], toPos[idx]
+
+		if line.op != diffInsert {
+			fromPos[idx+1]++
+		}
+
+		if line.op != diffDelete {
+			toPos[idx+1]++
+		}
+
+		if line.op != diffEqual {
+			changes = append(changes, idx)
+		}
+	}
+
+	if len(changes) == 0 {
+		return ""
+	}
+
+	text := &strings.Builder{}
+	fmt.Fprintf(text, "--- %s\n+++ %s\n", from.Name, to.Name)
+
+	for next := 0; next < len(changes); {
+		first, last := changes[next], changes[next]
+
+		// the hunks with overlapping context are merged
+		for next++; next < len(changes) && changes[next]-last-1 <= 2*diffContext; next++ {
+			last = changes[next]
+		}
+
+		start, end := max(0, first-diffContext), min(len(script), last+diffContext+1)
+		fmt.Fprintf(text, "@@ -%s +%s @@\n",
+			hunkRange(fromPos[start], fromPos[end]),
+			hunkRange(toPos[start], toPos[end]),
+		)
+
+		for _, line := range script[start:end] {
+			text.WriteString(string(line.op) + line.text + "\n")
+		}
+	}
+
+	return text.String()
+}
+
+func sideBySideColumn(text string, width int) string {
+	if len(text) > width {
+		return text[:width]
+	}
+
+	return text + strings.Repeat(" ", width-len(text))
+}
+
+// SideBySideDiff returns the diff of the resource variants in two columns,
+// the changed lines are marked with "|", "<" or ">" like in diff -y.
+func SideBySideDiff(from, to Variant, width int) string {
+	script := diffLines(from.lines(), to.lines())
+	column := (width - 3) / 2 //nolint:mnd
+	text := &strings.Builder{}
+
+	row := func(left string, marker byte, right string) {
+		line := fmt.Sprintf("%s %c %s", sideBySideColumn(left, column), marker, right)
+		text.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+
+	row(from.Name, ' ', to.Name)
+
+	for idx := 0; idx < len(script); {
+		if script[idx].op == diffEqual {
+			row(script[idx].text, ' ', script[idx].text)
+			idx++
+
+			continue
+		}
+
+		deleted, inserted := []string{}, []string{}
+
+		for ; idx < len(script) && script[idx].op != diffEqual; idx++ {
+			if script[idx].op == diffDelete {
+				deleted = append(deleted, script[idx].text)
+			} else {
+				inserted = append(inserted, script[idx].text)
+			}
+		}
+
+		for line := range max(len(deleted), len(inserted)) {
+			switch {
+			case line >= len(deleted):
+				row("", '>', inserted[line])
+			case line >= len(inserted):
+				row(deleted[line], '<', "")
+			default:
+				row(deleted[line], '|', inserted[line])
+			}
+		}
+	}
+
+	return text.String()
+}
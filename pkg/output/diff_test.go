@@ -0,0 +1,114 @@
+package output_test
+
+import (
+	"testing"
+
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestClusterVariants(t *testing.T) {
+	resources := verifyResources()
+	id := resid.FromRNode(yaml.MustParse(appDevA))
+
+	names := func(variants []output.Variant) []string {
+		result := []string{}
+		for _, variant := range variants {
+			result = append(result, variant.Name)
+		}
+
+		return result
+	}
+
+	want := []string{"dev-a", "prod-a", "prod-b", "test-a", "test-b"}
+	if diff := cmp.Diff(want, names(output.ClusterVariants(resources, id, false))); diff != "" {
+		t.Errorf("cluster variants mismatch, +got -want:\n%s", diff)
+	}
+
+	want = []string{"test", "dev", "prod-a", "prod-b"}
+	if diff := cmp.Diff(want, names(output.ClusterVariants(resources, id, true))); diff != "" {
+		t.Errorf("grouped variants mismatch, +got -want:\n%s", diff)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	from := output.Variant{Name: "dev-a", Node: yaml.MustParse(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myapp
+data:
+  a: "1"
+  b: "2"
+  c: "3"
+  d: "4"
+  e: "5"
+  f: "6"
+  g: "7"
+  h: "8"
+  i: "9"
+`)}
+	to := output.Variant{Name: "prod-a", Node: yaml.MustParse(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myapp
+data:
+  a: "1"
+  b: "two"
+  c: "3"
+  d: "4"
+  e: "5"
+  f: "6"
+  g: "7"
+  h: "8"
+  i: "9"
+  j: "10"
+`)}
+
+	wantUnified := `--- dev-a
++++ prod-a
+@@ -4,7 +4,7 @@
+   name: myapp
+ data:
+   a: "1"
+-  b: "2"
++  b: "two"
+   c: "3"
+   d: "4"
+   e: "5"
+@@ -12,3 +12,4 @@
+   g: "7"
+   h: "8"
+   i: "9"
++  j: "10"
+`
+	if diff := cmp.Diff(wantUnified, output.UnifiedDiff(from, to)); diff != "" {
+		t.Errorf("unified diff mismatch, +got -want:\n%s", diff)
+	}
+
+	if diff := output.UnifiedDiff(from, from); diff != "" {
+		t.Errorf("unexpected diff of the same variant:\n%s", diff)
+	}
+
+	wantSideBySide := `dev-a            prod-a
+apiVersion: v1   apiVersion: v1
+kind: ConfigMa   kind: ConfigMap
+metadata:        metadata:
+  name: myapp      name: myapp
+data:            data:
+  a: "1"           a: "1"
+  b: "2"       |   b: "two"
+  c: "3"           c: "3"
+  d: "4"           d: "4"
+  e: "5"           e: "5"
+  f: "6"           f: "6"
+  g: "7"           g: "7"
+  h: "8"           h: "8"
+  i: "9"           i: "9"
+               >   j: "10"
+`
+	if diff := cmp.Diff(wantSideBySide, output.SideBySideDiff(from, to, 31)); diff != "" {
+		t.Errorf("side-by-side diff mismatch, +got -want:\n%s", diff)
+	}
+}
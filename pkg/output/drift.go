@@ -0,0 +1,144 @@
+package output
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// DriftStatus is the state of the live resource compared to the desired one.
+type DriftStatus string
+
+const (
+	// DriftMissing resources are desired, but not found in the cluster.
+	DriftMissing DriftStatus = "missing"
+	// DriftExtra resources are found in the cluster, but not desired.
+	DriftExtra DriftStatus = "extra"
+	// DriftModified resources have fields differing from the desired ones.
+	DriftModified DriftStatus = "modified"
+)
+
+type ClusterDrift struct {
+	Cluster string      `json:"cluster" yaml:"cluster"`
+	Status  DriftStatus `json:"status"  yaml:"status"`
+}
+
+type FieldDrift struct {
+	Path    string `json:"path"    yaml:"path"`
+	Message string `json:"message" yaml:"message"`
+}
+
+type ResourceDrift struct {
+	Cluster  string       `json:"cluster"          yaml:"cluster"`
+	Resource string       `json:"resource"         yaml:"resource"`
+	Status   DriftStatus  `json:"status"           yaml:"status"`
+	Fields   []FieldDrift `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// DriftReport lists the desired clusters missing in the live source and the
+// resources of the live clusters differing from the desired state.
+type DriftReport struct {
+	Clusters  []ClusterDrift  `json:"clusters,omitempty" yaml:"clusters,omitempty"`
+	Resources []ResourceDrift `json:"resources"          yaml:"resources"`
+}
+
+func (report *DriftReport) Empty() bool {
+	return len(report.Clusters) == 0 && len(report.Resources) == 0
+}
+
+// String returns the human readable report, a line per resource followed by
+// the indented field paths.
+func (report *DriftReport) String() string {
+	text := &strings.Builder{}
+
+	for _, cluster := range report.Clusters {
+		fmt.Fprintf(text, "%s: %s\n", cluster.Cluster, cluster.Status)
+	}
+
+	for _, res := range report.Resources {
+		fmt.Fprintf(text, "%s: %s: %s\n", res.Cluster, res.Resource, res.Status)
+
+		for _, field := range res.Fields {
+			fmt.Fprintf(text, "  %s: %s\n", field.Path, field.Message)
+		}
+	}
+
+	return text.String()
+}
+
+// diffResources compares the resources of the cluster, want is the desired
+// state.
+func diffResources(cluster string, want, got map[resid.ResId]*yaml.RNode) []ResourceDrift {
+	ids := slices.Collect(maps.Keys(want))
+	for id := range got {
+		if _, found := want[id]; !found {
+			ids = append(ids, id)
+		}
+	}
+
+	slices.SortFunc(ids, func(a, b resid.ResId) int { return strings.Compare(a.String(), b.String()) })
+
+	diffs := []ResourceDrift{}
+
+	for _, id := range ids {
+		diff := ResourceDrift{Cluster: cluster, Resource: id.String()}
+
+		switch wantNode, gotNode := want[id], got[id]; {
+		case gotNode == nil:
+			diff.Status = DriftMissing
+		case wantNode == nil:
+			diff.Status = DriftExtra
+		default:
+			compareNodes("", wantNode.YNode(), gotNode.YNode(), func(path, msg string) {
+				diff.Fields = append(diff.Fields, FieldDrift{Path: path, Message: msg})
+			})
+
+			if len(diff.Fields) == 0 {
+				continue
+			}
+
+			diff.Status = DriftModified
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	return diffs
+}
+
+// Drift compares the live resources with the desired ones, the clusters are
+// matched by name. The desired clusters missing in the live source are
+// reported as missing.
+func Drift(desired, live *types.ClusterResources) *DriftReport {
+	report := &DriftReport{Resources: []ResourceDrift{}}
+
+	for clusterID, cluster := range desired.Clusters.All() {
+		liveID, err := live.Clusters.ID(cluster.Name)
+		if err != nil {
+			report.Clusters = append(report.Clusters, ClusterDrift{Cluster: cluster.Name, Status: DriftMissing})
+
+			continue
+		}
+
+		diffs := diffResources(
+			cluster.Name,
+			maps.Collect(desired.Cluster(clusterID)),
+			maps.Collect(live.Cluster(liveID)),
+		)
+		report.Resources = append(report.Resources, diffs...)
+	}
+
+	for _, cluster := range live.Clusters.All() {
+		if _, err := desired.Clusters.ID(cluster.Name); err != nil {
+			slog.Warn("live cluster is not desired", "cluster", cluster.Name)
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,88 @@
+package output_test
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func clusterResources(byName map[string][]*yaml.RNode) *types.ClusterResources {
+	resources := &types.ClusterResources{
+		Clusters:  types.NewClusterIndex(),
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{},
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(byName)) {
+		nodes := byName[name]
+		clusterID := resources.Clusters.Add(types.Cluster{Name: name})
+
+		for _, node := range nodes {
+			id := resid.FromRNode(node)
+			if resources.Resources[id] == nil {
+				resources.Resources[id] = map[types.ClusterID]*yaml.RNode{}
+			}
+
+			resources.Resources[id][clusterID] = node
+		}
+	}
+
+	return resources
+}
+
+func TestDrift(t *testing.T) {
+	const extra = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+  namespace: myapp
+`
+
+	modified := yaml.MustParse(appProdA)
+	if err := modified.PipeE(yaml.Lookup("spec"), yaml.SetField("replicas", yaml.NewScalarRNode("4"))); err != nil {
+		t.Fatal(err)
+	}
+
+	desired := clusterResources(map[string][]*yaml.RNode{
+		"dev-a":  {yaml.MustParse(appDevA)},
+		"prod-a": {yaml.MustParse(appProdA)},
+		"prod-b": {yaml.MustParse(appProdB)},
+		"prod-c": {yaml.MustParse(appProdB)},
+	})
+	live := clusterResources(map[string][]*yaml.RNode{
+		"dev-a":  {yaml.MustParse(appDevA), yaml.MustParse(extra)},
+		"prod-a": {modified},
+		"prod-b": {},
+		"test-a": {yaml.MustParse(appTestA)},
+	})
+
+	report := output.Drift(desired, live)
+	want := `prod-c: missing
+dev-a: ConfigMap.v1.[noGrp]/extra.myapp: extra
+prod-a: Deployment.v1.apps/myapp.myapp: modified
+  spec.replicas: want 3, got 4
+prod-b: Deployment.v1.apps/myapp.myapp: missing
+`
+
+	if diff := cmp.Diff(want, report.String()); diff != "" {
+		t.Errorf("drift report mismatch, +got -want:\n%s", diff)
+	}
+
+	if report.Empty() {
+		t.Error("drift is not detected")
+	}
+
+	unreachable := output.Drift(desired, clusterResources(map[string][]*yaml.RNode{}))
+	if unreachable.Empty() || len(unreachable.Clusters) != 4 {
+		t.Errorf("missing clusters are not detected: %v", unreachable.Clusters)
+	}
+
+	if !output.Drift(desired, desired).Empty() {
+		t.Error("unexpected drift of the same resources")
+	}
+}
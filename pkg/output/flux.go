@@ -0,0 +1,188 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	defaultFluxName      = "fleet"
+	defaultFluxNamespace = "flux-system"
+	defaultFluxSource    = "flux-system"
+	defaultFluxInterval  = "10m"
+
+	defaultFluxClustersPath types.PathTemplate = "clusters/${CLUSTER}"
+)
+
+var errUnsupportedFlux = errors.New("output is neither components nor chart")
+
+// FluxOutput stores the wrapped output and the Flux objects reconciling it
+// in every cluster: a Kustomization of the cluster overlay, or a HelmRelease
+// of the chart.
+type FluxOutput struct {
+	// Output is the wrapped components or helm chart output.
+	Output    Impl   `yaml:"-"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	// Source is the name of the GitRepository with the exported manifests.
+	Source   string `yaml:"source"`
+	Interval string `yaml:"interval"`
+	// Clusters is the directory of the cluster Flux objects.
+	Clusters types.PathTemplate `yaml:"clusters"`
+}
+
+type fluxSourceRef struct {
+	Kind string `yaml:"kind"`
+	Name string `yaml:"name"`
+}
+
+type fluxMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+type fluxKustomization struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   fluxMetadata `yaml:"metadata"`
+	Spec       struct {
+		Interval  string        `yaml:"interval"`
+		Path      string        `yaml:"path"`
+		Prune     bool          `yaml:"prune"`
+		SourceRef fluxSourceRef `yaml:"sourceRef"`
+	} `yaml:"spec"`
+}
+
+type fluxChartSpec struct {
+	Chart       string        `yaml:"chart"`
+	SourceRef   fluxSourceRef `yaml:"sourceRef"`
+	ValuesFiles []string      `yaml:"valuesFiles,omitempty"`
+}
+
+type fluxHelmRelease struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   fluxMetadata `yaml:"metadata"`
+	Spec       struct {
+		Interval        string `yaml:"interval"`
+		ReleaseName     string `yaml:"releaseName"`
+		TargetNamespace string `yaml:"targetNamespace,omitempty"`
+		Chart           struct {
+			Spec fluxChartSpec `yaml:"spec"`
+		} `yaml:"chart"`
+		Values map[string]any `yaml:"values,omitempty"`
+	} `yaml:"spec"`
+}
+
+func (out *FluxOutput) metadata() fluxMetadata {
+	return fluxMetadata{
+		Name:      withDefault(out.Name, defaultFluxName),
+		Namespace: withDefault(out.Namespace, defaultFluxNamespace),
+	}
+}
+
+func (out *FluxOutput) sourceRef() fluxSourceRef {
+	return fluxSourceRef{Kind: "GitRepository", Name: withDefault(out.Source, defaultFluxSource)}
+}
+
+func (out *FluxOutput) kustomization(overlays types.PathTemplate, cluster types.Cluster) any {
+	kust := &fluxKustomization{APIVersion: "kustomize.toolkit.fluxcd.io/v1", Kind: "Kustomization"}
+	kust.Metadata = out.metadata()
+	kust.Spec.Interval = withDefault(out.Interval, defaultFluxInterval)
+	kust.Spec.Path = "./" + overlays.Expand(types.PathVars{Cluster: &cluster})
+	kust.Spec.Prune = true
+	kust.Spec.SourceRef = out.sourceRef()
+
+	return kust
+}
+
+//nolint:lll
+func (out *FluxOutput) helmRelease(chartOut *ChartOutput, clusterID types.ClusterID, cluster types.Cluster) any {
+	paths := chartOut.Paths.withDefaults()
+	release := &fluxHelmRelease{APIVersion: "helm.toolkit.fluxcd.io/v2", Kind: "HelmRelease"}
+	release.Metadata = out.metadata()
+	release.Spec.Interval = withDefault(out.Interval, defaultFluxInterval)
+	release.Spec.ReleaseName = withDefault(chartOut.HelmChart.ReleaseName, chartOut.HelmChart.Name)
+	release.Spec.TargetNamespace = chartOut.HelmChart.Namespace
+	release.Spec.Chart.Spec = fluxChartSpec{
+		Chart:     "./" + paths.Chart.Expand(types.PathVars{Chart: chartOut.HelmChart.Name}),
+		SourceRef: out.sourceRef(),
+	}
+
+	if chartOut.OverlayStyle == "" || chartOut.OverlayStyle == KustomizeOverlays {
+		release.Spec.Values = chartOut.chart.Instance(clusterID).ValuesInline
+
+		return release
+	}
+
+	// presets are stored in separate values files
+	chartSpec := &release.Spec.Chart.Spec
+	for _, preset := range chartOut.chart.Presets(clusterID) {
+		chartSpec.ValuesFiles = append(chartSpec.ValuesFiles, "./"+paths.Values.Expand(types.PathVars{Group: preset}))
+	}
+
+	chartSpec.ValuesFiles = append(chartSpec.ValuesFiles, "./"+paths.Values.Expand(types.PathVars{Cluster: &cluster, Group: cluster.Name}))
+
+	return release
+}
+
+// object returns the Flux object reconciling the wrapped output in the cluster.
+func (out *FluxOutput) object(clusterID types.ClusterID, cluster types.Cluster) any {
+	switch wrapped := out.Output.(type) {
+	case *ChartOutput:
+		return out.helmRelease(wrapped, clusterID, cluster)
+	case *ComponentsOutput:
+		return out.kustomization(wrapped.Paths.withDefaults().Overlays, cluster)
+	default:
+		return nil
+	}
+}
+
+func (out *FluxOutput) Store(env *types.Env, resources *types.ClusterResources) error {
+	switch out.Output.(type) {
+	case *ComponentsOutput, *ChartOutput:
+	default:
+		return fmt.Errorf("%w: %T", errUnsupportedFlux, out.Output)
+	}
+
+	if err := out.Output.Store(env, resources); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	clustersPath := out.Clusters
+	if clustersPath == "" {
+		clustersPath = defaultFluxClustersPath
+	}
+
+	for clusterID, cluster := range resources.Clusters.All() {
+		body, err := yaml.Marshal(out.object(clusterID, cluster))
+		if err != nil {
+			return fmt.Errorf("unable to generate Flux objects: %w", err)
+		}
+
+		dir := clustersPath.Expand(types.PathVars{Cluster: &cluster})
+		if err := env.FileSys.MkdirAll(dir); err != nil {
+			return fmt.Errorf("unable to create %s: %w", dir, err)
+		}
+
+		path := filepath.Join(dir, out.metadata().Name+".yaml")
+		if err := env.FileSys.WriteFile(path, body); err != nil {
+			return fmt.Errorf("unable to store %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (out *FluxOutput) Render(env *types.Env, clusters *types.ClusterIndex) (map[types.ClusterID][]*yaml.RNode, error) {
+	renderer, ok := out.Output.(Renderer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrVerifyUnsupported, out.Output)
+	}
+
+	return renderer.Render(env, clusters) //nolint:wrapcheck
+}
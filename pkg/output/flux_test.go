@@ -0,0 +1,121 @@
+package output_test
+
+import (
+	"testing"
+
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestFluxOutput(t *testing.T) {
+	tests := map[string]struct {
+		output output.Impl
+		want   string
+	}{
+		"components": {
+			output: &output.ComponentsOutput{},
+			want: `apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: fleet
+  namespace: flux-system
+spec:
+  interval: 10m
+  path: ./overlays/prod-a
+  prune: true
+  sourceRef:
+    kind: GitRepository
+    name: fleet-repo
+`,
+		},
+		"chart": {
+			output: &output.ChartOutput{
+				HelmChart: types.HelmChart{Name: "myapp", Version: "v0.1", Namespace: "myapp"},
+			},
+			want: `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: fleet
+  namespace: flux-system
+spec:
+  interval: 10m
+  releaseName: myapp
+  targetNamespace: myapp
+  chart:
+    spec:
+      chart: ./charts/myapp
+      sourceRef:
+        kind: GitRepository
+        name: fleet-repo
+  values:
+    presets:
+    - prod
+`,
+		},
+		"chart-values": {
+			output: &output.ChartOutput{
+				HelmChart:    types.HelmChart{Name: "myapp", Version: "v0.1"},
+				OverlayStyle: output.ValuesOverlays,
+			},
+			want: `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: fleet
+  namespace: flux-system
+spec:
+  interval: 10m
+  releaseName: myapp
+  chart:
+    spec:
+      chart: ./charts/myapp
+      sourceRef:
+        kind: GitRepository
+        name: fleet-repo
+      valuesFiles:
+      - ./values/prod.yaml
+      - ./values/prod-a.yaml
+`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			clusters := types.NewClusterIndex()
+			devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+			prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+			byCluster := map[types.ClusterID]*yaml.RNode{
+				devA:  yaml.MustParse(appDevA),
+				prodA: yaml.MustParse(appProdA),
+			}
+			resources := &types.ClusterResources{
+				Clusters: clusters,
+				Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{
+					resid.FromRNode(byCluster[devA]): byCluster,
+				},
+			}
+			env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+			out := &output.FluxOutput{Output: test.output, Source: "fleet-repo"}
+
+			if err := out.Store(env, resources); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := env.FileSys.ReadFile("clusters/prod-a/fleet.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(test.want, string(got)); diff != "" {
+				t.Errorf("Flux objects mismatch, +got -want:\n%s", diff)
+			}
+
+			if !env.FileSys.Exists("clusters/dev-a/fleet.yaml") {
+				t.Error("dev-a Flux objects are not stored")
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// OverlayStyle defines how the helm chart is deployed to the clusters.
+type OverlayStyle string
+
+const (
+	// KustomizeOverlays inflates the chart in kustomize overlays, with the
+	// presets and cluster values inlined.
+	KustomizeOverlays OverlayStyle = "kustomize"
+	// HelmfileOverlays stores values files and a helmfile.yaml with a
+	// release per cluster.
+	HelmfileOverlays OverlayStyle = "helmfile"
+	// ValuesOverlays stores values files only, e.g. for helm upgrade or
+	// Argo CD.
+	ValuesOverlays OverlayStyle = "values"
+)
+
+const helmfileName = "helmfile.yaml"
+
+var errUnsupportedOverlayStyle = errors.New("unsupported overlay style")
+
+func (style *OverlayStyle) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid overlay style: %w", err)
+	}
+
+	switch value := OverlayStyle(raw); value {
+	case "", KustomizeOverlays, HelmfileOverlays, ValuesOverlays:
+		*style = value
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedOverlayStyle, raw)
+	}
+
+	return nil
+}
+
+func (chart *Chart) valuesFile(values chartValues) *yaml.RNode {
+	node := values.node(chart.Values)
+	if chart.Values == StructuredValues {
+		return node
+	}
+
+	root := yaml.NewMapRNode(nil)
+	if err := root.SetMapField(node, "global"); err != nil {
+		panic(err)
+	}
+
+	return root
+}
+
+// Presets returns the names of the presets assigned to the cluster.
+func (chart *Chart) Presets(cluster types.ClusterID) []string {
+	return slices.Sorted(maps.Keys(chart.clusterPresets[cluster]))
+}
+
+// PresetValues returns the preset as a standalone values file.
+func (chart *Chart) PresetValues(preset string) *yaml.RNode {
+	return chart.valuesFile(chart.presetValues[preset])
+}
+
+// ClusterValues returns the values unique to the cluster as a values file.
+func (chart *Chart) ClusterValues(cluster types.ClusterID) *yaml.RNode {
+	return chart.valuesFile(chart.inlineValues[cluster])
+}
+
+func (out *ChartOutput) storeValuesFiles(env *types.Env, resources *types.ClusterResources, chart *Chart) error {
+	paths := out.Paths.withDefaults()
+	files := map[string]*yaml.RNode{}
+	owners := map[string]string{}
+	addFile := func(path, owner string, values *yaml.RNode) error {
+		if other, found := owners[path]; found && other != owner {
+			return fmt.Errorf("%w: %s for %s and %s", errDuplicatePath, path, other, owner)
+		}
+
+		owners[path] = owner
+		files[path] = values
+
+		return nil
+	}
+
+	for clusterID, cluster := range resources.Clusters.All() {
+		for _, preset := range chart.Presets(clusterID) {
+			path := paths.Values.Expand(types.PathVars{Group: preset})
+			if err := addFile(path, "preset "+preset, chart.PresetValues(preset)); err != nil {
+				return err
+			}
+		}
+
+		path := paths.Values.Expand(types.PathVars{Cluster: &cluster, Group: cluster.Name})
+		if err := addFile(path, cluster.Name, chart.ClusterValues(clusterID)); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		if err := env.FileSys.MkdirAll(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("unable to create values dir: %w", err)
+		}
+
+		if err := env.FileSys.WriteFile(path, []byte(files[path].MustString())); err != nil {
+			return fmt.Errorf("unable to store values file %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+type helmfileRelease struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Chart       string            `yaml:"chart"`
+	KubeContext string            `yaml:"kubeContext"`
+	Labels      map[string]string `yaml:"labels"`
+	Values      []string          `yaml:"values"`
+}
+
+type helmfile struct {
+	Releases []helmfileRelease `yaml:"releases"`
+}
+
+//nolint:lll
+func (out *ChartOutput) storeHelmfile(env *types.Env, resources *types.ClusterResources, chart *Chart, chartDir string) error {
+	paths := out.Paths.withDefaults()
+	releaseName := out.HelmChart.ReleaseName
+
+	if releaseName == "" {
+		releaseName = out.HelmChart.Name
+	}
+
+	spec := helmfile{}
+
+	for clusterID, cluster := range resources.Clusters.All() {
+		release := helmfileRelease{
+			Name:        releaseName,
+			Namespace:   out.HelmChart.Namespace,
+			Chart:       "./" + chartDir,
+			KubeContext: cluster.Name,
+			Labels:      map[string]string{"cluster": cluster.Name},
+		}
+
+		for _, preset := range chart.Presets(clusterID) {
+			release.Values = append(release.Values, paths.Values.Expand(types.PathVars{Group: preset}))
+		}
+
+		clusterValues := paths.Values.Expand(types.PathVars{Cluster: &cluster, Group: cluster.Name})
+		release.Values = append(release.Values, clusterValues)
+		spec.Releases = append(spec.Releases, release)
+	}
+
+	body, err := yaml.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("unable to generate %s: %w", helmfileName, err)
+	}
+
+	if err := env.FileSys.WriteFile(helmfileName, body); err != nil {
+		return fmt.Errorf("unable to store %s: %w", helmfileName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,311 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/filters/patchstrategicmerge"
+	"sigs.k8s.io/kustomize/kyaml/openapi"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// PatchFormat defines the format of the patches generated for components.
+type PatchFormat string
+
+const (
+	StrategicMergePatch PatchFormat = "strategicMerge"
+	JSON6902Patch       PatchFormat = "json6902"
+)
+
+var (
+	errUnsupportedPatchFormat = errors.New("unsupported patch format")
+	errJSONPatchTarget        = errors.New("json patch file must target a single resource")
+)
+
+func (format *PatchFormat) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid patch format: %w", err)
+	}
+
+	switch value := PatchFormat(raw); value {
+	case "", StrategicMergePatch, JSON6902Patch:
+		*format = value
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedPatchFormat, raw)
+	}
+
+	return nil
+}
+
+// jsonPatches converts strategic-merge patches of every component into
+// RFC 6902 patches, by applying the components in the same order kustomize
+// does and comparing resources before and after each patch. The patches
+// requiring different operations for the clusters are kept as is.
+func (comps *Components) jsonPatches() (map[string]map[resid.ResId]*yaml.RNode, error) {
+	result := map[string]map[resid.ResId]*yaml.RNode{}
+	texts := map[string]map[resid.ResId]string{}
+	// kustomize applies json patches to the resources decoded from JSON,
+	// the resources holding large integers keep the strategic-merge
+	// patches not to have them printed as floats
+	unsafe := map[resid.ResId]bool{}
+
+	for _, comp := range comps.byName {
+		for resID, resNode := range comp.resources {
+			if hasExponentInts(resNode.YNode()) {
+				unsafe[resID] = true
+			}
+		}
+
+		for resID, patch := range comp.patches {
+			if hasExponentInts(patch.YNode()) {
+				unsafe[resID] = true
+			}
+		}
+	}
+
+	for _, clusterID := range slices.Sorted(maps.Keys(comps.byCluster)) {
+		items := slices.Clone(comps.byCluster[clusterID])
+		sort.Sort(componentsOrder(items))
+
+		states := map[resid.ResId]*yaml.RNode{}
+
+		for _, comp := range items {
+			for resID, resNode := range comp.resources {
+				states[resID] = resNode.Copy()
+			}
+
+			if len(comp.patches) > 0 && result[comp.name] == nil {
+				result[comp.name] = map[resid.ResId]*yaml.RNode{}
+				texts[comp.name] = map[resid.ResId]string{}
+			}
+
+			for resID, patch := range comp.patches {
+				after, ops, err := jsonPatch(resID, states[resID], patch)
+				if err != nil {
+					return nil, err
+				}
+
+				states[resID] = after
+
+				if unsafe[resID] {
+					result[comp.name][resID] = patch
+				}
+
+				if result[comp.name][resID] == patch {
+					continue
+				}
+
+				// the clusters of the component need different operations,
+				// e.g. list indices, the resource keeps the strategic-merge
+				// patch producing the same result
+				text := ops.MustString()
+				if prev, found := texts[comp.name][resID]; found && prev != text {
+					result[comp.name][resID] = patch
+
+					continue
+				}
+
+				texts[comp.name][resID] = text
+				result[comp.name][resID] = ops
+			}
+		}
+	}
+
+	// kustomize rejects empty patches, they are left when the broader
+	// components already hold the values, e.g. an empty mapping
+	for _, patches := range result {
+		maps.DeleteFunc(patches, func(_ resid.ResId, ops *yaml.RNode) bool {
+			return len(ops.Content()) == 0
+		})
+	}
+
+	return result, nil
+}
+
+func jsonPatch(resID resid.ResId, before, patch *yaml.RNode) (*yaml.RNode, *yaml.RNode, error) {
+	merged, err := patchstrategicmerge.Filter{Patch: patch.Copy()}.Filter([]*yaml.RNode{before.Copy()})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to apply patch to %s: %w", resID, err)
+	}
+
+	after := merged[0]
+	ops := &jsonPatchBuilder{ops: yaml.NewListRNode()}
+	schema := openapi.SchemaForResourceType(resID.AsTypeMeta())
+	ops.diff("", schema, before.YNode(), after.YNode())
+
+	return after, ops.ops, nil
+}
+
+type jsonPatchBuilder struct {
+	ops *yaml.RNode
+}
+
+func (b *jsonPatchBuilder) add(operation, path string, value *yaml.Node) {
+	opNode := yaml.NewMapRNode(nil)
+	opNode.YNode().Content = []*yaml.Node{
+		yaml.NewStringRNode("op").YNode(), yaml.NewStringRNode(operation).YNode(),
+		yaml.NewStringRNode("path").YNode(), yaml.NewStringRNode(path).YNode(),
+	}
+
+	if value != nil {
+		if err := opNode.PipeE(yaml.SetField("value", yaml.NewRNode(yaml.CopyYNode(value)))); err != nil {
+			panic(err)
+		}
+	}
+
+	if err := b.ops.PipeE(yaml.Append(opNode.YNode())); err != nil {
+		panic(err)
+	}
+}
+
+func jsonPointer(path, key string) string {
+	key = strings.ReplaceAll(key, "~", "~0")
+	key = strings.ReplaceAll(key, "/", "~1")
+
+	return path + "/" + key
+}
+
+func equalNodes(left, right *yaml.Node) bool {
+	leftText, errLeft := yaml.String(left, yaml.Flow)
+	rightText, errRight := yaml.String(right, yaml.Flow)
+
+	return errLeft == nil && errRight == nil && leftText == rightText
+}
+
+func (b *jsonPatchBuilder) diff(path string, schema *openapi.ResourceSchema, before, after *yaml.Node) {
+	switch {
+	case before.Kind != after.Kind:
+		b.add("replace", path, after)
+	case before.Kind == yaml.MappingNode:
+		b.diffMapping(path, schema, before, after)
+	case before.Kind == yaml.SequenceNode:
+		b.diffSequence(path, schema, before, after)
+	case !equalNodes(before, after):
+		b.add("replace", path, after)
+	}
+}
+
+func (b *jsonPatchBuilder) diffMapping(path string, schema *openapi.ResourceSchema, before, after *yaml.Node) {
+	beforeFields := map[string]*yaml.Node{}
+	for i := 0; i < len(before.Content); i += 2 {
+		beforeFields[before.Content[i].Value] = before.Content[i+1]
+	}
+
+	afterFields := map[string]*yaml.Node{}
+	for i := 0; i < len(after.Content); i += 2 {
+		afterFields[after.Content[i].Value] = after.Content[i+1]
+	}
+
+	for i := 0; i < len(before.Content); i += 2 {
+		key := before.Content[i].Value
+		if _, found := afterFields[key]; !found {
+			b.add("remove", jsonPointer(path, key), nil)
+		}
+	}
+
+	for i := 0; i < len(after.Content); i += 2 {
+		key, value := after.Content[i].Value, after.Content[i+1]
+
+		beforeValue, found := beforeFields[key]
+		if !found {
+			b.add("add", jsonPointer(path, key), value)
+
+			continue
+		}
+
+		var fieldSchema *openapi.ResourceSchema
+		if schema != nil {
+			fieldSchema = schema.Field(key)
+		}
+
+		b.diff(jsonPointer(path, key), fieldSchema, beforeValue, value)
+	}
+}
+
+func elementKeys(node *yaml.Node, key []string) ([]string, bool) {
+	values, err := yaml.NewRNode(node).ElementValuesList(key)
+	if err != nil || len(values) != len(node.Content) {
+		return nil, false
+	}
+
+	keys := make([]string, 0, len(values))
+	unique := map[string]struct{}{}
+
+	for _, value := range values {
+		elementKey := kvKey(key, value)
+		if _, duplicate := unique[elementKey]; duplicate {
+			return nil, false
+		}
+
+		unique[elementKey] = struct{}{}
+		keys = append(keys, elementKey)
+	}
+
+	return keys, true
+}
+
+func kvKey(key, values []string) string {
+	parts := make([]string, len(key))
+	for i := range key {
+		parts[i] = key[i] + "=" + values[i]
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (b *jsonPatchBuilder) diffSequence(path string, schema *openapi.ResourceSchema, before, after *yaml.Node) {
+	var key []string
+	if schema != nil {
+		_, key = schema.PatchStrategyAndKeyList()
+	}
+
+	if len(key) == 0 {
+		if !equalNodes(before, after) {
+			b.add("replace", path, after)
+		}
+
+		return
+	}
+
+	beforeKeys, beforeOK := elementKeys(before, key)
+	afterKeys, afterOK := elementKeys(after, key)
+
+	kept := slices.DeleteFunc(slices.Clone(beforeKeys), func(k string) bool { return !slices.Contains(afterKeys, k) })
+	keptOrder := slices.DeleteFunc(slices.Clone(afterKeys), func(k string) bool { return !slices.Contains(beforeKeys, k) })
+
+	if !beforeOK || !afterOK || !slices.Equal(kept, keptOrder) {
+		if !equalNodes(before, after) {
+			b.add("replace", path, after)
+		}
+
+		return
+	}
+
+	for idx := len(beforeKeys) - 1; idx >= 0; idx-- {
+		if !slices.Contains(afterKeys, beforeKeys[idx]) {
+			b.add("remove", path+"/"+strconv.Itoa(idx), nil)
+		}
+	}
+
+	for idx, elementKey := range afterKeys {
+		if !slices.Contains(beforeKeys, elementKey) {
+			b.add("add", path+"/"+strconv.Itoa(idx), after.Content[idx])
+		}
+	}
+
+	for idx, elementKey := range afterKeys {
+		beforeIdx := slices.Index(beforeKeys, elementKey)
+		if beforeIdx < 0 {
+			continue
+		}
+
+		b.diff(path+"/"+strconv.Itoa(idx), schema.Elements(), before.Content[beforeIdx], after.Content[idx])
+	}
+}
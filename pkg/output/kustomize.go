@@ -1,20 +1,64 @@
 package output
 
 import (
+	"errors"
 	"fmt"
+	"iter"
 	"slices"
 
+	"github.com/Mirantis/ktl/pkg/fsutil"
 	"github.com/Mirantis/ktl/pkg/resource"
 	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
-type KustomizeOutput struct{}
+const defaultClusterPath types.PathTemplate = "${CLUSTER}"
+
+var errMultipleClusters = errors.New("multiple clusters require perCluster output")
+
+type KustomizeOutput struct {
+	Paths      Paths `yaml:"paths"`
+	PerCluster bool  `yaml:"perCluster"`
+}
 
 func (out *KustomizeOutput) Store(env *types.Env, resources *types.ClusterResources) error {
+	if !out.PerCluster {
+		if clusters := len(resources.Clusters.IDs()); clusters > 1 {
+			return fmt.Errorf("%w: %d clusters", errMultipleClusters, clusters)
+		}
+
+		return out.store(env.FileSys, resources.All(), types.PathVars{})
+	}
+
+	clusterPath := out.Paths.Overlays
+	if clusterPath == "" {
+		clusterPath = defaultClusterPath
+	}
+
+	if err := checkOverlayPaths(clusterPath, resources.Clusters); err != nil {
+		return err
+	}
+
+	for clusterID, cluster := range resources.Clusters.All() {
+		vars := types.PathVars{Cluster: &cluster}
+		fileSys := fsutil.Sub(env.FileSys, clusterPath.Expand(vars))
+
+		if err := out.store(fileSys, resources.Cluster(clusterID), vars); err != nil {
+			return fmt.Errorf("unable to store %s: %w", cluster.Name, err)
+		}
+	}
+
+	return nil
+}
+
+//nolint:lll
+func (out *KustomizeOutput) store(fileSys filesys.FileSystem, nodes iter.Seq2[resid.ResId, *yaml.RNode], vars types.PathVars) error {
 	kust := &types.Kustomization{}
 	resourceStore := &resource.FileStore{
-		FileSystem:    env.FileSys,
-		NameGenerator: resource.FileName,
+		FileSystem:    fileSys,
+		NameGenerator: resource.FileNameTemplate(out.Paths.Resources, vars),
 		PostProcessor: func(path string, body []byte) []byte {
 			kust.Resources = append(kust.Resources, path)
 
@@ -22,7 +66,7 @@ func (out *KustomizeOutput) Store(env *types.Env, resources *types.ClusterResour
 		},
 	}
 
-	if err := resourceStore.WriteAll(resources.All()); err != nil {
+	if err := resourceStore.WriteAll(nodes); err != nil {
 		return fmt.Errorf("unable to store files: %w", err)
 	}
 
@@ -0,0 +1,88 @@
+package output_test
+
+import (
+	"testing"
+
+	"github.com/Mirantis/ktl/pkg/e2e"
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestKustomizePerCluster(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	byCluster := map[types.ClusterID]*yaml.RNode{
+		devA:  yaml.MustParse(appDevA),
+		prodA: yaml.MustParse(appProdA),
+	}
+	resources := &types.ClusterResources{
+		Clusters: clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{
+			resid.FromRNode(byCluster[devA]): byCluster,
+		},
+	}
+	env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+
+	if err := (&output.KustomizeOutput{}).Store(env, resources); err == nil {
+		t.Fatalf("want err, got none")
+	}
+
+	out := &output.KustomizeOutput{PerCluster: true}
+	if err := out.Store(env, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	got := e2e.ReadFiles(t, env.FileSys, "/")
+	want := map[string]string{
+		"dev-a/kustomization.yaml":           "resources:\n- myapp/myapp-deployment.yaml\n",
+		"dev-a/myapp/myapp-deployment.yaml":  appDevA,
+		"prod-a/kustomization.yaml":          "resources:\n- myapp/myapp-deployment.yaml\n",
+		"prod-a/myapp/myapp-deployment.yaml": appProdA,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected result, +got -want:\n%s", diff)
+	}
+}
+
+func TestKustomizeDuplicatePaths(t *testing.T) {
+	clusters := types.NewClusterIndex()
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	prodB := clusters.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod"}})
+	byCluster := map[types.ClusterID]*yaml.RNode{
+		prodA: yaml.MustParse(appProdA),
+		prodB: yaml.MustParse(appProdB),
+	}
+	resources := &types.ClusterResources{
+		Clusters: clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{
+			resid.FromRNode(byCluster[prodA]): byCluster,
+		},
+	}
+	env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+	outputs := map[string]output.Impl{
+		"kustomize":       &output.KustomizeOutput{PerCluster: true, Paths: output.Paths{Overlays: "clusters/${TAG}"}},
+		"components":      &output.ComponentsOutput{Paths: output.Paths{Overlays: "clusters/${TAG}"}},
+		"component-paths": &output.ComponentsOutput{Paths: output.Paths{Components: "components/shared"}},
+		"chart": &output.ChartOutput{
+			HelmChart: types.HelmChart{Name: "myapp", Version: "v0.1"},
+			Paths:     output.Paths{Overlays: "clusters/${TAG}"},
+		},
+		"values": &output.ChartOutput{
+			HelmChart:    types.HelmChart{Name: "myapp", Version: "v0.1"},
+			OverlayStyle: output.ValuesOverlays,
+			Paths:        output.Paths{Values: "values/${TAG}.yaml"},
+		},
+	}
+
+	for name, out := range outputs {
+		if err := out.Store(env, resources); err == nil {
+			t.Errorf("%s: want err, got none", name)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+
+	"github.com/Mirantis/ktl/pkg/resource"
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ComponentsLayout defines how the varying values are distributed between
+// the components.
+type ComponentsLayout string
+
+const (
+	// GreedyLayout creates a component for every distinct set of clusters
+	// sharing the same value.
+	GreedyLayout ComponentsLayout = "greedy"
+	// LayeredLayout pushes values down into the broadest layer (all clusters,
+	// tags, individual clusters) and overrides them in the narrower layers,
+	// if that reduces the total number of components and patched values.
+	LayeredLayout ComponentsLayout = "layered"
+)
+
+var errUnsupportedLayout = errors.New("unsupported components layout")
+
+func (layout *ComponentsLayout) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid components layout: %w", err)
+	}
+
+	switch value := ComponentsLayout(raw); value {
+	case "", GreedyLayout, LayeredLayout:
+		*layout = value
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedLayout, raw)
+	}
+
+	return nil
+}
+
+// LayoutCost measures the size of the generated components.
+type LayoutCost struct {
+	Components int
+	Values     int
+}
+
+func (cost LayoutCost) Total() int {
+	return cost.Components + cost.Values
+}
+
+type placement struct {
+	clusters []types.ClusterID
+	value    *yaml.Node
+}
+
+func greedyPlacements(variants []*resource.ValueGroup) []placement {
+	placements := make([]placement, 0, len(variants))
+	for _, variant := range variants {
+		placements = append(placements, placement{variant.Clusters, variant.Value})
+	}
+
+	return placements
+}
+
+type layer struct {
+	name     string
+	clusters []types.ClusterID
+}
+
+func (comps *Components) layers(parentIDs []types.ClusterID, desired map[types.ClusterID]int) []layer {
+	candidates := map[string]layer{}
+	addCandidate := func(ids []types.ClusterID) {
+		if len(ids) < 2 { //nolint:mnd
+			return
+		}
+
+		for _, id := range ids {
+			if _, found := desired[id]; !found {
+				return
+			}
+		}
+
+		name := comps.clusters.Group(ids...)
+		candidates[name] = layer{name: name, clusters: slices.Sorted(slices.Values(ids))}
+	}
+
+	addCandidate(parentIDs)
+
+	for _, ids := range comps.clusters.Tags() {
+		addCandidate(ids)
+	}
+
+	for _, comp := range comps.byName {
+		addCandidate(comp.clusters)
+	}
+
+	layers := slices.Collect(maps.Values(candidates))
+	sort.Sort(layersOrder(layers))
+
+	return layers
+}
+
+func majority(clusters []types.ClusterID, desired map[types.ClusterID]int) (int, int) {
+	counts := map[int]int{}
+
+	for _, id := range clusters {
+		if desired[id] != absent {
+			counts[desired[id]]++
+		}
+	}
+
+	best, bestCount := 0, 0
+
+	for variant, count := range counts {
+		if count > bestCount || (count == bestCount && variant < best) {
+			best, bestCount = variant, count
+		}
+	}
+
+	return best, bestCount
+}
+
+const absent = -1
+
+//nolint:lll
+func (comps *Components) layeredPlacements(parentIDs []types.ClusterID, variants []*resource.ValueGroup, removable bool) []placement {
+	desired := map[types.ClusterID]int{}
+
+	if removable {
+		for _, id := range parentIDs {
+			desired[id] = absent
+		}
+	}
+
+	for idx, variant := range variants {
+		for _, id := range variant.Clusters {
+			desired[id] = idx
+		}
+	}
+
+	effective := map[types.ClusterID]int{}
+	placements := []placement{}
+	matches := func(id types.ClusterID) bool {
+		variant, found := effective[id]
+		if !found {
+			return desired[id] == absent
+		}
+
+		return variant == desired[id]
+	}
+
+	for _, layer := range comps.layers(parentIDs, desired) {
+		best, count := majority(layer.clusters, desired)
+		if count == 0 {
+			continue
+		}
+
+		mismatches := 0
+
+		for _, id := range layer.clusters {
+			if !matches(id) {
+				mismatches++
+			}
+		}
+
+		// each remaining mismatch costs an override in a narrower layer
+		if 1+len(layer.clusters)-count >= mismatches {
+			continue
+		}
+
+		for _, id := range layer.clusters {
+			effective[id] = best
+		}
+
+		placements = append(placements, placement{layer.clusters, variants[best].Value})
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(desired)) {
+		if matches(id) {
+			continue
+		}
+
+		value := &yaml.Node{Kind: yaml.ScalarNode, Tag: yaml.NodeTagNull, Value: "null"}
+		if variant := desired[id]; variant != absent {
+			value = variants[variant].Value
+		}
+
+		placements = append(placements, placement{[]types.ClusterID{id}, value})
+	}
+
+	return placements
+}
+
+type layersOrder []layer
+
+func (o layersOrder) Len() int      { return len(o) }
+func (o layersOrder) Swap(a, b int) { o[a], o[b] = o[b], o[a] }
+func (o layersOrder) Less(a, b int) bool {
+	if d := len(o[a].clusters) - len(o[b].clusters); d != 0 {
+		return d > 0 // descending order, same as componentsOrder
+	}
+
+	return o[a].name < o[b].name
+}
@@ -0,0 +1,234 @@
+package output
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Mirantis/ktl/pkg/resource"
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/sets"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// commonMetadataFields are the metadata mappings shared by the templates via
+// the named templates, e.g. "myapp.labels".
+var commonMetadataFields = []string{yaml.LabelsField, yaml.AnnotationsField}
+
+// metadataMapping returns the metadata field of the template, unless it is
+// replaced by a variable.
+func (chart *Chart) metadataMapping(resNode *yaml.RNode, field string) *yaml.Node {
+	node, err := resNode.Pipe(yaml.Lookup(yaml.MetadataField, field))
+	if err != nil || node == nil || node.YNode().Kind != yaml.MappingNode {
+		return nil
+	}
+
+	if tmpl := chart.directives[node.YNode()]; tmpl != nil && tmpl.value != "" {
+		return nil
+	}
+
+	return node.YNode()
+}
+
+// metadataTemplate returns the expression of the label or annotation derived
+// from the release or cluster name, e.g. "app.kubernetes.io/instance". The
+// release name is only known if it is set explicitly.
+func (chart *Chart) metadataTemplate(path resource.Query, variants []*resource.ValueGroup, optional bool) *directive {
+	if !chart.CommonMetadata || optional || len(path) != 3 || path[0] != yaml.MetadataField ||
+		!slices.Contains(commonMetadataFields, path[1]) {
+		return nil
+	}
+
+	for _, variant := range variants {
+		if variant.Value.Kind != yaml.ScalarNode || variant.Value.ShortTag() != yaml.NodeTagString {
+			return nil
+		}
+	}
+
+	if release := chart.meta.ReleaseName; len(variants) == 1 && variants[0].Value.Value == release && release != "" {
+		return &directive{value: ".Release.Name", quote: true, shared: true}
+	}
+
+	prefix, suffix, found := chart.clusterAffixes(variants)
+	if !found {
+		return nil
+	}
+
+	chart.clusterNames()
+
+	value := chart.reference(clusterNameKey)
+	if prefix != "" || suffix != "" {
+		value = fmt.Sprintf("print %q (%s) %q", prefix, value, suffix)
+	}
+
+	return &directive{variable: clusterNameKey, value: value, quote: true, shared: true}
+}
+
+// clusterAffixes returns the text around the cluster name, if every variant
+// is the cluster name with the same prefix and suffix.
+func (chart *Chart) clusterAffixes(variants []*resource.ValueGroup) (string, string, bool) {
+	var prefix, suffix string
+
+	if len(variants) < 2 { //nolint:mnd
+		return "", "", false
+	}
+
+	for idx, variant := range variants {
+		if len(variant.Clusters) != 1 {
+			return "", "", false
+		}
+
+		name := chart.clusters.Cluster(variant.Clusters[0]).Name
+
+		if idx == 0 {
+			var found bool
+			if prefix, suffix, found = strings.Cut(variant.Value.Value, name); !found {
+				return "", "", false
+			}
+		}
+
+		if variant.Value.Value != prefix+name+suffix {
+			return "", "", false
+		}
+	}
+
+	return prefix, suffix, true
+}
+
+// clusterNames sets the cluster name variable in the values of every cluster.
+func (chart *Chart) clusterNames() {
+	if chart.variables.Has(clusterNameKey) {
+		return
+	}
+
+	chart.variables.Insert(clusterNameKey)
+	chart.schemas[clusterNameKey] = jsonSchema{"type": "string"}
+
+	for _, id := range chart.clusterIDs {
+		values := chart.values([]types.ClusterID{id})
+		values[clusterNameKey] = yaml.NewStringRNode(chart.clusters.Cluster(id).Name).YNode()
+	}
+}
+
+// constantFields returns the scalar fields of the mapping, that are the same
+// in all clusters or derived from the release or cluster name.
+func (chart *Chart) constantFields(node *yaml.Node) map[string]*yaml.Node {
+	fields := map[string]*yaml.Node{}
+
+	for i := 0; i < len(node.Content); i += 2 {
+		value := node.Content[i+1]
+		if tmpl, found := chart.directives[value]; (found && !tmpl.shared) || value.Kind != yaml.ScalarNode {
+			continue
+		}
+
+		fields[node.Content[i].Value] = value
+	}
+
+	return fields
+}
+
+// expression returns the shared expression of the field, if any.
+func (chart *Chart) expression(node *yaml.Node) string {
+	if tmpl, found := chart.directives[node]; found {
+		return tmpl.value
+	}
+
+	return ""
+}
+
+func (chart *Chart) sameField(a, b *yaml.Node) bool {
+	return a.Value == b.Value && a.ShortTag() == b.ShortTag() && chart.expression(a) == chart.expression(b)
+}
+
+// commonFields returns the constant metadata fields repeated in more than a
+// half of the templates, at least in two.
+func (chart *Chart) commonFields(field string) map[string]*yaml.Node {
+	type fieldValue struct{ key, value, tag, expression string }
+
+	counts := map[fieldValue]int{}
+	nodes := map[fieldValue]*yaml.Node{}
+
+	for _, resNode := range chart.templates {
+		mapping := chart.metadataMapping(resNode, field)
+		if mapping == nil {
+			continue
+		}
+
+		for key, value := range chart.constantFields(mapping) {
+			id := fieldValue{key, value.Value, value.ShortTag(), chart.expression(value)}
+			counts[id]++
+			nodes[id] = value
+		}
+	}
+
+	common := map[string]*yaml.Node{}
+
+	for id, count := range counts {
+		if count >= 2 && 2*count > len(chart.templates) {
+			common[id.key] = nodes[id]
+		}
+	}
+
+	return common
+}
+
+// extractCommonMetadata replaces the common metadata fields with includes of
+// the named templates, it returns the definitions of these templates.
+func (chart *Chart) extractCommonMetadata() []byte {
+	defines := []byte{}
+
+	for _, field := range commonMetadataFields {
+		common := chart.commonFields(field)
+		if len(common) == 0 {
+			continue
+		}
+
+		name := chart.meta.Name + "." + field
+		keys := slices.Sorted(maps.Keys(common))
+		defined := &yaml.Node{Kind: yaml.MappingNode}
+
+		for _, key := range keys {
+			defined.Content = append(defined.Content, yaml.NewStringRNode(key).YNode(), common[key])
+		}
+
+		writer := &templateWriter{directives: chart.directives}
+		writer.mapping(defined, 0)
+
+		defines = fmt.Appendf(defines, "{{- define %q -}}\n%s{{- end -}}\n", name, writer.buf.String())
+
+		for _, resNode := range chart.templates {
+			mapping := chart.metadataMapping(resNode, field)
+			if mapping == nil {
+				continue
+			}
+
+			fields := chart.constantFields(mapping)
+			if !chart.hasFields(fields, common) {
+				continue
+			}
+
+			tmpl, found := chart.directives[mapping]
+			if !found {
+				tmpl = &directive{}
+				chart.directives[mapping] = tmpl
+			}
+
+			tmpl.include = name
+			tmpl.omit = sets.String{}
+			tmpl.omit.Insert(keys...)
+		}
+	}
+
+	return defines
+}
+
+func (chart *Chart) hasFields(fields, subset map[string]*yaml.Node) bool {
+	for key, value := range subset {
+		if field, found := fields[key]; !found || !chart.sameField(field, value) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,289 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+	helmyaml "sigs.k8s.io/yaml"
+)
+
+// mergeValues deep-merges src into dst, same as helm does for values files.
+func mergeValues(dst, src map[string]any) map[string]any {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]any)
+		dstMap, dstIsMap := dst[key].(map[string]any)
+
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+
+			continue
+		}
+
+		dst[key] = value
+	}
+
+	return dst
+}
+
+func indent(spaces int, text string) string {
+	pad := strings.Repeat(" ", spaces)
+
+	return pad + strings.ReplaceAll(text, "\n", "\n"+pad)
+}
+
+// chartFuncs implements the subset of the helm template functions used by
+// the generated charts, the templates calling other functions fail to parse
+// instead of rendering differently than helm.
+func chartFuncs(tmpl *template.Template) template.FuncMap {
+	return template.FuncMap{
+		"include": func(name string, data any) (string, error) {
+			buf := &bytes.Buffer{}
+			if err := tmpl.ExecuteTemplate(buf, name, data); err != nil {
+				return "", fmt.Errorf("include %s: %w", name, err)
+			}
+
+			return buf.String(), nil
+		},
+		"toYaml": func(value any) (string, error) {
+			body, err := helmyaml.Marshal(value)
+			if err != nil {
+				return "", fmt.Errorf("toYaml: %w", err)
+			}
+
+			return strings.TrimSuffix(string(body), "\n"), nil
+		},
+		"indent": indent,
+		"quote": func(value any) string {
+			if value == nil {
+				return ""
+			}
+
+			return fmt.Sprintf("%q", fmt.Sprint(value))
+		},
+		"nindent": func(spaces int, text string) string {
+			return "\n" + indent(spaces, text)
+		},
+		"set": func(dict map[string]any, key string, value any) map[string]any {
+			dict[key] = value
+
+			return dict
+		},
+		"mergeOverwrite": func(dst map[string]any, srcs ...map[string]any) map[string]any {
+			for _, src := range srcs {
+				mergeValues(dst, src)
+			}
+
+			return dst
+		},
+	}
+}
+
+// parseValues decodes the values same as helm, i.e. through JSON, with the
+// numbers decoded as float64.
+func parseValues(body []byte) (map[string]any, error) {
+	values := map[string]any{}
+	if err := helmyaml.Unmarshal(body, &values); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if values == nil {
+		values = map[string]any{}
+	}
+
+	return values, nil
+}
+
+func readValues(fileSys filesys.FileSystem, path string) (map[string]any, error) {
+	body, err := fileSys.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	values, err := parseValues(body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// inlineValues returns the valuesInline of the kustomization as seen by helm,
+// kustomize passes them in a values file.
+func inlineValues(helmChart types.HelmChart) (map[string]any, error) {
+	body, err := helmyaml.Marshal(helmChart.ValuesInline)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode values of %s: %w", helmChart.Name, err)
+	}
+
+	values, err := parseValues(body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse values of %s: %w", helmChart.Name, err)
+	}
+
+	return values, nil
+}
+
+// renderChart renders the chart templates with the values overrides applied
+// on top of the chart values.yaml.
+func renderChart(fileSys filesys.FileSystem, dir string, meta types.HelmChart, overrides ...map[string]any) ([]*yaml.RNode, error) {
+	values, err := readValues(fileSys, filepath.Join(dir, valuesFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, override := range overrides {
+		mergeValues(values, override)
+	}
+
+	templatesPath := filepath.Join(dir, templatesDir)
+	names := []string{}
+	tmpl := template.New(meta.Name).Option("missingkey=zero")
+	tmpl.Funcs(chartFuncs(tmpl))
+
+	entries, err := fileSys.ReadDir(templatesPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load chart templates: %w", err)
+	}
+
+	for _, name := range entries {
+		path := filepath.Join(templatesPath, name)
+		if fileSys.IsDir(path) {
+			continue
+		}
+
+		body, err := fileSys.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read template: %w", err)
+		}
+
+		if _, err := tmpl.New(name).Parse(string(body)); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", name, err)
+		}
+
+		names = append(names, name)
+	}
+
+	releaseName := meta.ReleaseName
+	if releaseName == "" {
+		releaseName = meta.Name
+	}
+
+	data := map[string]any{
+		"Values":  values,
+		"Release": map[string]any{"Name": releaseName, "Namespace": meta.Namespace},
+		"Chart":   map[string]any{"Name": meta.Name, "Version": meta.Version},
+	}
+	nodes := []*yaml.RNode{}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		if strings.HasPrefix(filepath.Base(name), "_") {
+			continue
+		}
+
+		buf := &bytes.Buffer{}
+		if err := tmpl.ExecuteTemplate(buf, name, data); err != nil {
+			return nil, fmt.Errorf("unable to render %s: %w", name, err)
+		}
+
+		// same as helm, the missing values are printed as "<no value>"
+		// despite missingkey=zero, so they are dropped from the output
+		rendered := strings.ReplaceAll(buf.String(), "<no value>", "")
+
+		templateNodes, err := kio.FromBytes([]byte(rendered))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse rendered %s: %w", name, err)
+		}
+
+		nodes = append(nodes, templateNodes...)
+	}
+
+	return nodes, nil
+}
+
+// clusterValues returns the values overrides of the cluster, in the order
+// they are applied.
+func (out *ChartOutput) clusterValues(env *types.Env, clusterID types.ClusterID, cluster types.Cluster) ([]map[string]any, error) {
+	paths := out.Paths.withDefaults()
+
+	if out.OverlayStyle == HelmfileOverlays || out.OverlayStyle == ValuesOverlays {
+		if out.chart == nil {
+			return nil, fmt.Errorf("%w: presets of %s are unknown", ErrVerifyUnsupported, cluster.Name)
+		}
+
+		files := []string{}
+		for _, preset := range out.chart.Presets(clusterID) {
+			files = append(files, paths.Values.Expand(types.PathVars{Group: preset}))
+		}
+
+		files = append(files, paths.Values.Expand(types.PathVars{Cluster: &cluster, Group: cluster.Name}))
+		overrides := []map[string]any{}
+
+		for _, path := range files {
+			values, err := readValues(env.FileSys, path)
+			if err != nil {
+				return nil, err
+			}
+
+			overrides = append(overrides, values)
+		}
+
+		return overrides, nil
+	}
+
+	kustPath := filepath.Join(paths.Overlays.Expand(types.PathVars{Cluster: &cluster}), konfig.DefaultKustomizationFileName())
+
+	body, err := env.FileSys.ReadFile(kustPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", kustPath, err)
+	}
+
+	kust := &types.Kustomization{}
+	if err := yaml.Unmarshal(body, kust); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", kustPath, err)
+	}
+
+	overrides := []map[string]any{}
+	for _, helmChart := range kust.HelmCharts {
+		values, err := inlineValues(helmChart)
+		if err != nil {
+			return nil, err
+		}
+
+		overrides = append(overrides, values)
+	}
+
+	return overrides, nil
+}
+
+func (out *ChartOutput) Render(env *types.Env, clusters *types.ClusterIndex) (map[types.ClusterID][]*yaml.RNode, error) {
+	paths := out.Paths.withDefaults()
+	chartDir := paths.Chart.Expand(types.PathVars{Chart: out.HelmChart.Name})
+	result := map[types.ClusterID][]*yaml.RNode{}
+
+	for clusterID, cluster := range clusters.All() {
+		overrides, err := out.clusterValues(env, clusterID, cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes, err := renderChart(env.FileSys, chartDir, out.HelmChart, overrides...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to render chart for %s: %w", cluster.Name, err)
+		}
+
+		result[clusterID] = nodes
+	}
+
+	return result, nil
+}
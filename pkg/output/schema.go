@@ -0,0 +1,278 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Mirantis/ktl/pkg/resource"
+	"sigs.k8s.io/kustomize/kyaml/openapi"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+	valuesDef       = "#/definitions/values"
+)
+
+// jsonSchema is a JSON Schema document or a subschema.
+type jsonSchema map[string]any
+
+func nodeType(schema *openapi.ResourceSchema, node *yaml.Node) string {
+	if !schema.IsMissingOrNull() && len(schema.Schema.Type) == 1 {
+		return schema.Schema.Type[0]
+	}
+
+	switch {
+	case node.Kind == yaml.MappingNode:
+		return "object"
+	case node.Kind == yaml.SequenceNode:
+		return "array"
+	}
+
+	switch node.ShortTag() {
+	case yaml.NodeTagInt:
+		return "integer"
+	case yaml.NodeTagFloat:
+		return "number"
+	case yaml.NodeTagBool:
+		return "boolean"
+	case yaml.NodeTagString:
+		return "string"
+	default:
+		return ""
+	}
+}
+
+// nodesSchema infers the schema of the observed nodes. Object fields present
+// in every observed node are required.
+func nodesSchema(schema *openapi.ResourceSchema, nodes []*yaml.Node) jsonSchema {
+	result := jsonSchema{}
+	if len(nodes) == 0 {
+		return result
+	}
+
+	nodeKind := nodeType(schema, nodes[0])
+	if nodeKind != "" {
+		result["type"] = nodeKind
+	}
+
+	switch nodes[0].Kind {
+	case yaml.MappingNode:
+		fields := map[string][]*yaml.Node{}
+
+		for _, node := range nodes {
+			for i := 0; i < len(node.Content); i += 2 {
+				key := node.Content[i].Value
+				fields[key] = append(fields[key], node.Content[i+1])
+			}
+		}
+
+		properties := jsonSchema{}
+		required := []string{}
+
+		for _, key := range slices.Sorted(maps.Keys(fields)) {
+			var fieldSchema *openapi.ResourceSchema
+			if !schema.IsMissingOrNull() {
+				fieldSchema = schema.Field(key)
+			}
+
+			properties[key] = nodesSchema(fieldSchema, fields[key])
+
+			if len(fields[key]) == len(nodes) {
+				required = append(required, key)
+			}
+		}
+
+		result["properties"] = properties
+		if len(required) > 0 {
+			result["required"] = required
+		}
+	case yaml.SequenceNode:
+		var elementSchema *openapi.ResourceSchema
+		if !schema.IsMissingOrNull() {
+			elementSchema = schema.Elements()
+		}
+
+		elements := []*yaml.Node{}
+		for _, node := range nodes {
+			elements = append(elements, node.Content...)
+		}
+
+		if len(elements) > 0 {
+			result["items"] = nodesSchema(elementSchema, elements)
+		}
+	}
+
+	return result
+}
+
+// variableSchema infers the schema of a chart variable, scalar variables are
+// restricted to the observed values.
+func variableSchema(schema *openapi.ResourceSchema, variants []*resource.ValueGroup, description string) jsonSchema {
+	nodes := make([]*yaml.Node, 0, len(variants))
+	enum := make([]any, 0, len(variants))
+
+	for _, variant := range variants {
+		nodes = append(nodes, variant.Value)
+
+		var value any
+		if err := variant.Value.Decode(&value); err != nil {
+			panic(err)
+		}
+
+		enum = append(enum, value)
+	}
+
+	result := nodesSchema(schema, nodes)
+	if nodes[0].Kind == yaml.ScalarNode {
+		result["enum"] = enum
+	}
+
+	if description != "" {
+		result["description"] = description
+	}
+
+	return result
+}
+
+func (chart *Chart) flagSchema() jsonSchema {
+	if chart.Values == StructuredValues {
+		return jsonSchema{"type": "boolean"}
+	}
+
+	return jsonSchema{"type": "string", "enum": []any{enabledKey}}
+}
+
+// valuesSchema returns the schema of the chart variables, either as flat
+// properties or as nested objects.
+func (chart *Chart) valuesSchema() jsonSchema {
+	root := jsonSchema{"type": "object", "properties": jsonSchema{}}
+
+	for _, name := range slices.Sorted(maps.Keys(chart.schemas)) {
+		if chart.Values != StructuredValues {
+			root["properties"].(jsonSchema)[name] = chart.schemas[name] //nolint:forcetypeassert
+
+			continue
+		}
+
+		path := strings.Split(name, ".")
+		parent := root
+
+		for _, key := range path[:len(path)-1] {
+			properties := parent["properties"].(jsonSchema) //nolint:forcetypeassert
+
+			child, found := properties[key].(jsonSchema)
+			if !found {
+				child = jsonSchema{"type": "object", "properties": jsonSchema{}}
+				properties[key] = child
+			}
+
+			parent = child
+		}
+
+		parent["properties"].(jsonSchema)[path[len(path)-1]] = chart.schemas[name] //nolint:forcetypeassert
+	}
+
+	return root
+}
+
+// requiredSchema returns the schema requiring the variables of the paths
+// present in all clusters, as nested objects for the structured values.
+func (chart *Chart) requiredSchema() jsonSchema {
+	root := jsonSchema{}
+	addRequired := func(schema jsonSchema, key string) {
+		required, _ := schema["required"].([]string)
+		if !slices.Contains(required, key) {
+			schema["required"] = append(required, key)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(chart.required)) {
+		path := []string{name}
+		if chart.Values == StructuredValues {
+			path = strings.Split(name, ".")
+		}
+
+		parent := root
+
+		for _, key := range path[:len(path)-1] {
+			addRequired(parent, key)
+
+			properties, found := parent["properties"].(jsonSchema)
+			if !found {
+				properties = jsonSchema{}
+				parent["properties"] = properties
+			}
+
+			child, found := properties[key].(jsonSchema)
+			if !found {
+				child = jsonSchema{}
+				properties[key] = child
+			}
+
+			parent = child
+		}
+
+		addRequired(parent, path[len(path)-1])
+	}
+
+	return root
+}
+
+func (chart *Chart) schema() jsonSchema {
+	presetSchemas := jsonSchema{}
+	for _, preset := range slices.Sorted(maps.Keys(chart.presetValues)) {
+		presetSchemas[preset] = jsonSchema{"$ref": valuesDef}
+	}
+
+	presets := jsonSchema{"type": "array"}
+	if len(chart.presetValues) > 0 {
+		presets["items"] = jsonSchema{"enum": slices.Sorted(maps.Keys(chart.presetValues))}
+	}
+
+	properties := jsonSchema{
+		presetsKey: presets,
+		presetValuesKey: jsonSchema{
+			"type":       "object",
+			"properties": presetSchemas,
+		},
+	}
+
+	root := jsonSchema{
+		"$schema":     jsonSchemaDraft,
+		"type":        "object",
+		"definitions": jsonSchema{"values": chart.valuesSchema()},
+		"properties":  properties,
+	}
+
+	values := []any{jsonSchema{"$ref": valuesDef}}
+
+	// helm validates the values before the templates merge the presets, the
+	// variables are only complete if the presets are separate values files
+	if chart.ExternalPresets && len(chart.required) > 0 {
+		values = append(values, chart.requiredSchema())
+	}
+
+	switch {
+	case chart.Values == StructuredValues:
+		root["allOf"] = values
+	case len(values) == 1:
+		properties["global"] = values[0]
+	default:
+		properties["global"] = jsonSchema{"allOf": values}
+	}
+
+	return root
+}
+
+func (chart *Chart) schemaJSON() ([]byte, error) {
+	body, err := json.MarshalIndent(chart.schema(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate values schema: %w", err)
+	}
+
+	return append(body, '\n'), nil
+}
@@ -0,0 +1,284 @@
+package output
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Mirantis/ktl/pkg/resource"
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/openapi"
+)
+
+// similarity holds the number of the resource paths, where the clusters hold
+// the same variant, and the number of the compared paths.
+type similarity struct {
+	agree [][]int
+	total [][]int
+}
+
+func newSimilarity(size int) *similarity {
+	sim := &similarity{agree: make([][]int, size), total: make([][]int, size)}
+	for i := range size {
+		sim.agree[i] = make([]int, size)
+		sim.total[i] = make([]int, size)
+	}
+
+	return sim
+}
+
+// add compares the variants of a path, the clusters without the path hold
+// the absent variant.
+func (sim *similarity) add(variants []*resource.ValueGroup) {
+	const absent = -1
+
+	held := slices.Repeat([]int{absent}, len(sim.agree))
+
+	for idx, variant := range variants {
+		for _, id := range variant.Clusters {
+			held[id] = idx
+		}
+	}
+
+	for i := range held {
+		for j := i + 1; j < len(held); j++ {
+			if held[i] == absent && held[j] == absent {
+				continue
+			}
+
+			sim.total[i][j]++
+
+			if held[i] == held[j] {
+				sim.agree[i][j]++
+			}
+		}
+	}
+}
+
+func (sim *similarity) of(a, b types.ClusterID) float64 {
+	i, j := min(a, b), max(a, b)
+	if sim.total[i][j] == 0 {
+		return 1
+	}
+
+	return float64(sim.agree[i][j]) / float64(sim.total[i][j])
+}
+
+// layoutPath is a path of a resource with the variants of the clusters and
+// the clusters holding its parent.
+type layoutPath struct {
+	path      resource.Query
+	parentIDs []types.ClusterID
+	variants  []*resource.ValueGroup
+	isValue   bool
+}
+
+// layoutResource holds the paths of a resource, they are placed again for
+// every candidate set of tags without iterating over the resources.
+type layoutResource struct {
+	clusterIDs []types.ClusterID
+	paths      []layoutPath
+}
+
+// collectPaths iterates over the resources once, it returns the similarity
+// of the clusters and the paths placed by the components layout.
+func collectPaths(resources *types.ClusterResources) (*similarity, []layoutResource, error) {
+	sim := newSimilarity(len(resources.Clusters.IDs()))
+	layoutResources := []layoutResource{}
+
+	for _, resID := range resources.IDs() {
+		byCluster := resources.Resources[resID]
+		res := layoutResource{clusterIDs: slices.Sorted(maps.Keys(byCluster))}
+		coverage := map[string][]types.ClusterID{"": res.clusterIDs}
+		resIterator := resource.NewIterator(byCluster, openapi.SchemaForResourceType(resID.AsTypeMeta()))
+
+		for resIterator.Next() {
+			path := resIterator.Path()
+			sim.add(resource.GroupByValue(resIterator.Values()))
+
+			parentIDs := res.clusterIDs
+			if len(path) > 0 {
+				coverage[path.String()] = resIterator.Clusters()
+				parentIDs = coverage[path[:len(path)-1].String()]
+			}
+
+			res.paths = append(res.paths, layoutPath{path, parentIDs, placedVariants(resIterator), resIterator.IsValue()})
+		}
+
+		if err := resIterator.Error(); err != nil {
+			return nil, nil, fmt.Errorf("unable to compare the clusters: %w", err)
+		}
+
+		layoutResources = append(layoutResources, res)
+	}
+
+	return sim, layoutResources, nil
+}
+
+// linkage returns the groups merged by the average linkage hierarchical
+// clustering, the most similar first. The group of all clusters is omitted.
+func linkage(ids []types.ClusterID, sim *similarity) [][]types.ClusterID {
+	groups := [][]types.ClusterID{}
+	for _, id := range ids {
+		groups = append(groups, []types.ClusterID{id})
+	}
+
+	average := func(a, b []types.ClusterID) float64 {
+		sum := 0.0
+
+		for _, i := range a {
+			for _, j := range b {
+				sum += sim.of(i, j)
+			}
+		}
+
+		return sum / float64(len(a)*len(b))
+	}
+
+	merged := [][]types.ClusterID{}
+
+	for len(groups) > 2 { //nolint:mnd
+		bestA, bestB, best := 0, 1, -1.0
+
+		for a := range groups {
+			for b := a + 1; b < len(groups); b++ {
+				if value := average(groups[a], groups[b]); value > best {
+					bestA, bestB, best = a, b, value
+				}
+			}
+		}
+
+		group := slices.Sorted(slices.Values(slices.Concat(groups[bestA], groups[bestB])))
+		merged = append(merged, group)
+		groups[bestA] = group
+		groups = slices.Delete(groups, bestB, bestB+1)
+	}
+
+	return merged
+}
+
+// tagName returns the common prefix of the cluster names, e.g. "prod" for
+// "prod-a" and "prod-b", or a numbered group name.
+func tagName(names []string, used map[string]bool) string {
+	prefix := names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	prefix = strings.TrimRight(prefix, "-_.")
+	if prefix != "" && !used[prefix] {
+		return prefix
+	}
+
+	for idx := 1; ; idx++ {
+		name := "group-" + strconv.Itoa(idx)
+		if !used[name] {
+			return name
+		}
+	}
+}
+
+// layoutCost returns the cost of the components of the clusters tagged with
+// the groups, generated with the layout and patch format of the output.
+//
+//nolint:lll
+func layoutCost(resources *types.ClusterResources, layoutResources []layoutResource, out *ComponentsOutput, groups [][]types.ClusterID) LayoutCost {
+	clusters := types.NewClusterIndex()
+	tags := map[types.ClusterID][]string{}
+
+	for idx, group := range groups {
+		for _, id := range group {
+			tags[id] = append(tags[id], "tag-"+strconv.Itoa(idx))
+		}
+	}
+
+	// the cluster IDs are kept, the clusters are added in the same order
+	for id, cluster := range resources.Clusters.All() {
+		clusters.Add(types.Cluster{Name: cluster.Name, Tags: tags[id]})
+	}
+
+	comps := NewComponents(clusters)
+	comps.Layout = out.Layout
+	comps.PatchFormat = out.Patches
+
+	for _, res := range layoutResources {
+		comps.component(res.clusterIDs...)
+
+		for _, path := range res.paths {
+			for _, place := range comps.placements(path.path, path.parentIDs, path.variants, path.isValue) {
+				comps.component(place.clusters...)
+				comps.values++
+			}
+		}
+	}
+
+	return comps.Cost()
+}
+
+func compareCost(a, b LayoutCost) int {
+	return cmp.Or(cmp.Compare(a.Components, b.Components), cmp.Compare(a.Total(), b.Total()))
+}
+
+// SuggestTags groups the clusters by the similarity of their resources. The
+// groups of the hierarchical clustering are tagged, while the tags reduce
+// the number of the components generated by the output, up to maxTags. The
+// greedy layout generates the same components for any tags, so the tags are
+// only suggested for the layered layout.
+//
+//nolint:lll
+func SuggestTags(resources *types.ClusterResources, out *ComponentsOutput, maxTags int) ([]types.ClusterSelector, error) {
+	ids := resources.Clusters.IDs()
+
+	sim, layoutResources, err := collectPaths(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := linkage(ids, sim)
+	selected := [][]types.ClusterID{}
+	bestCost := layoutCost(resources, layoutResources, out, selected)
+
+	for len(selected) < maxTags && len(candidates) > 0 {
+		bestIdx := -1
+
+		for idx, candidate := range candidates {
+			cost := layoutCost(resources, layoutResources, out, append(slices.Clone(selected), candidate))
+			if compareCost(cost, bestCost) < 0 {
+				bestIdx, bestCost = idx, cost
+			}
+		}
+
+		if bestIdx < 0 {
+			break
+		}
+
+		selected = append(selected, candidates[bestIdx])
+		candidates = slices.Delete(candidates, bestIdx, bestIdx+1)
+	}
+
+	names := slices.Collect(resources.Clusters.Names(ids...))
+	selectors := []types.ClusterSelector{{Names: types.PatternSelector{Include: names}}}
+	used := map[string]bool{}
+
+	for _, name := range names {
+		used[name] = true
+	}
+
+	for _, group := range selected {
+		groupNames := slices.Collect(resources.Clusters.Names(group...))
+		tag := tagName(groupNames, used)
+		used[tag] = true
+
+		selectors = append(selectors, types.ClusterSelector{
+			Names: types.PatternSelector{Include: groupNames},
+			Tags:  types.StrList{tag},
+		})
+	}
+
+	return selectors, nil
+}
@@ -0,0 +1,50 @@
+package output_test
+
+import (
+	"testing"
+
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSuggestTags(t *testing.T) {
+	layered := &output.ComponentsOutput{Layout: output.LayeredLayout}
+	all := types.ClusterSelector{
+		Names: types.PatternSelector{Include: types.Patterns{"dev-a", "prod-a", "prod-b", "test-a", "test-b"}},
+	}
+	want := []types.ClusterSelector{
+		all,
+		{Names: types.PatternSelector{Include: types.Patterns{"test-a", "test-b"}}, Tags: types.StrList{"test"}},
+	}
+
+	for range 10 {
+		got, err := output.SuggestTags(verifyResources(), layered, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("suggested tags mismatch, +got -want:\n%s", diff)
+		}
+	}
+
+	// the greedy components do not depend on the tags
+	greedy, err := output.SuggestTags(verifyResources(), &output.ComponentsOutput{}, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]types.ClusterSelector{all}, greedy); diff != "" {
+		t.Errorf("suggested greedy tags mismatch, +got -want:\n%s", diff)
+	}
+
+	none, err := output.SuggestTags(verifyResources(), layered, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(none) != 1 || len(none[0].Tags) != 0 {
+		t.Errorf("want no tags, got %v", none)
+	}
+}
@@ -20,6 +20,16 @@ func (out *TableOutput) Store(env *types.Env, resources *types.ClusterResources)
 		return fmt.Errorf("invalid table output path: %w", errAbsPath)
 	}
 
+	body, err := writeTable(out.rows(resources))
+	if err != nil {
+		return err
+	}
+
+	return env.FileSys.WriteFile(path, body) //nolint:wrapcheck
+}
+
+// writeTable returns the rows as aligned columns.
+func writeTable(rows [][]string) ([]byte, error) {
 	buffer := bytes.NewBuffer(nil)
 
 	err := func() error {
@@ -30,7 +40,7 @@ func (out *TableOutput) Store(env *types.Env, resources *types.ClusterResources)
 		csvWriter.Comma = '\t'
 		defer csvWriter.Flush()
 
-		for _, row := range out.rows(resources) {
+		for _, row := range rows {
 			if err := csvWriter.Write(row); err != nil {
 				return err //nolint:wrapcheck
 			}
@@ -39,8 +49,8 @@ func (out *TableOutput) Store(env *types.Env, resources *types.ClusterResources)
 		return nil
 	}()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return env.FileSys.WriteFile(path, buffer.Bytes()) //nolint:wrapcheck
+	return buffer.Bytes(), nil
 }
@@ -0,0 +1,261 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/sets"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// directive holds the helm template expressions attached to a node of the
+// resource tree.
+type directive struct {
+	// variable is the name of the chart variable, it annotates the end of
+	// the conditional block.
+	variable string
+	// value is the expression replacing the node.
+	value string
+	// quote pipes the value through quote, e.g. for strings that look like
+	// numbers or span multiple lines.
+	quote bool
+	// toYaml pipes the value through toYaml, e.g. for the integers helm
+	// would print in exponent notation.
+	toYaml bool
+	// subtree renders the value as a YAML subtree of the given kind.
+	subtree yaml.Kind
+	// shared marks the values derived from the release or cluster name, the
+	// same expression in all templates.
+	shared bool
+	// condition is the expression enabling the node, or its mapping field.
+	condition string
+	// empty writes the empty container when none of its children are
+	// enabled, e.g. the labels left empty in some clusters.
+	empty bool
+	// include is the named template prepended to the mapping, it replaces
+	// the omitted fields.
+	include string
+	omit    sets.String
+}
+
+func (tmpl *directive) includes() bool {
+	return tmpl != nil && tmpl.include != ""
+}
+
+// templateWriter writes resource trees as helm templates. Nodes without
+// directives are encoded as is, preserving their style and comments.
+type templateWriter struct {
+	directives map[*yaml.Node]*directive
+	buf        strings.Builder
+	// prefix replaces the indentation of the next line, e.g. with the "- " of
+	// a sequence item.
+	prefix string
+}
+
+func (w *templateWriter) line(indent int, text string) {
+	// template actions and comments don't start the item, the "-" is
+	// written on its own line
+	if w.prefix != "" && (strings.HasPrefix(text, "{{") || strings.HasPrefix(text, "#")) {
+		w.buf.WriteString(strings.TrimSuffix(w.prefix, " "))
+		w.buf.WriteByte('\n')
+		w.prefix = ""
+	}
+
+	switch {
+	case w.prefix != "":
+		w.buf.WriteString(w.prefix)
+		w.prefix = ""
+	case text != "":
+		w.buf.WriteString(strings.Repeat(" ", indent))
+	}
+
+	w.buf.WriteString(text)
+	w.buf.WriteByte('\n')
+}
+
+// constant reports whether the node children are written as is, i.e. they
+// have no directives.
+func (w *templateWriter) constant(node *yaml.Node) bool {
+	for _, child := range node.Content {
+		if _, found := w.directives[child]; found || !w.constant(child) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// literal writes the node as encoded by kyaml.
+func (w *templateWriter) literal(indent int, node *yaml.Node) {
+	text, err := yaml.String(node)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		w.line(indent, line)
+	}
+}
+
+func (w *templateWriter) comments(indent int, comment string) {
+	if comment == "" {
+		return
+	}
+
+	for _, line := range strings.Split(comment, "\n") {
+		w.line(indent, line)
+	}
+}
+
+// keyText returns the mapping key, quoted if necessary.
+func keyText(key *yaml.Node) string {
+	text, err := yaml.String(key)
+	if err != nil {
+		panic(err)
+	}
+
+	return strings.TrimSuffix(text, "\n")
+}
+
+// expression returns the template expression of the value, subtrees are
+// indented by the given number of spaces.
+func (w *templateWriter) expression(tmpl *directive, indent int) string {
+	if tmpl.subtree != 0 {
+		return fmt.Sprintf("{{- toYaml (%s) | nindent %d }}", tmpl.value, indent)
+	}
+
+	if tmpl.quote {
+		return fmt.Sprintf("{{ %s | quote }}", tmpl.value)
+	}
+
+	if tmpl.toYaml {
+		return fmt.Sprintf("{{ %s | toYaml }}", tmpl.value)
+	}
+
+	return fmt.Sprintf("{{ %s }}", tmpl.value)
+}
+
+// emptyContainer returns the expression writing the empty container, if
+// every child of the node is conditional.
+func (w *templateWriter) emptyContainer(node *yaml.Node, tmpl *directive) string {
+	if tmpl == nil || !tmpl.empty || tmpl.includes() {
+		return ""
+	}
+
+	children, text := node.Content, "[]"
+	if node.Kind == yaml.MappingNode {
+		children, text = []*yaml.Node{}, "{}"
+
+		for i := 1; i < len(node.Content); i += 2 {
+			children = append(children, node.Content[i])
+		}
+	}
+
+	conditions := []string{}
+
+	for _, child := range children {
+		childTmpl := w.directives[child]
+		if childTmpl == nil || childTmpl.condition == "" {
+			return ""
+		}
+
+		conditions = append(conditions, "("+childTmpl.condition+")")
+	}
+
+	return fmt.Sprintf("{{ if not (or %s) }} %s{{ end }}", strings.Join(conditions, " "), text)
+}
+
+func (w *templateWriter) begin(indent int, tmpl *directive) {
+	if tmpl != nil && tmpl.condition != "" {
+		w.line(indent, fmt.Sprintf("{{- if %s }}", tmpl.condition))
+	}
+}
+
+func (w *templateWriter) end(indent int, tmpl *directive) {
+	if tmpl != nil && tmpl.condition != "" {
+		w.line(indent, fmt.Sprintf("{{- end }}{{/* %s */}}", tmpl.variable))
+	}
+}
+
+func (w *templateWriter) mapping(node *yaml.Node, indent int) {
+	tmpl := w.directives[node]
+	if tmpl.includes() {
+		w.line(indent, fmt.Sprintf("{{- include %q . | nindent %d }}", tmpl.include, indent))
+	}
+
+	for i := 0; i < len(node.Content); i += 2 {
+		if tmpl.includes() && tmpl.omit.Has(node.Content[i].Value) {
+			continue
+		}
+
+		w.field(node.Content[i], node.Content[i+1], indent)
+	}
+}
+
+func (w *templateWriter) field(key, value *yaml.Node, indent int) {
+	tmpl := w.directives[value]
+	w.begin(indent, tmpl)
+
+	switch {
+	case tmpl != nil && tmpl.value != "":
+		// sequences are not indented in mapping fields
+		valueIndent := indent + 2
+		if tmpl.subtree == yaml.SequenceNode {
+			valueIndent = indent
+		}
+
+		w.comments(indent, key.HeadComment)
+		w.line(indent, keyText(key)+": "+w.expression(tmpl, valueIndent))
+	case w.constant(value) && !tmpl.includes():
+		w.literal(indent, &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{key, value}})
+	case value.Kind == yaml.MappingNode:
+		w.comments(indent, key.HeadComment)
+		w.line(indent, keyText(key)+":"+w.emptyContainer(value, tmpl))
+		w.mapping(value, indent+2)
+	default:
+		w.comments(indent, key.HeadComment)
+		w.line(indent, keyText(key)+":"+w.emptyContainer(value, tmpl))
+		w.sequence(value, indent)
+	}
+
+	w.end(indent, tmpl)
+}
+
+func (w *templateWriter) sequence(node *yaml.Node, indent int) {
+	for _, item := range node.Content {
+		tmpl := w.directives[item]
+		w.begin(indent, tmpl)
+
+		switch {
+		case tmpl != nil && tmpl.value != "":
+			w.line(indent, "- "+w.expression(tmpl, indent+2))
+		case w.constant(item) && !tmpl.includes():
+			w.literal(indent, &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{item}})
+		case item.Kind == yaml.MappingNode:
+			w.prefix = strings.Repeat(" ", indent) + "- "
+			w.mapping(item, indent+2)
+		default:
+			w.prefix = strings.Repeat(" ", indent) + "- "
+			w.sequence(item, indent+2)
+		}
+
+		w.end(indent, tmpl)
+	}
+}
+
+// document writes the resource template, the header lines precede the
+// resource condition.
+func (w *templateWriter) document(node *yaml.Node, header ...string) string {
+	w.buf.Reset()
+
+	for _, line := range header {
+		w.line(0, line)
+	}
+
+	tmpl := w.directives[node]
+	w.begin(0, tmpl)
+	w.mapping(node, 0)
+	w.end(0, tmpl)
+
+	return w.buf.String()
+}
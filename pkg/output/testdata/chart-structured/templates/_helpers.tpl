@@ -0,0 +1,15 @@
+{{- define "merge_presets" -}}
+{{- $preset_values := .Values.preset_values -}}
+{{- $global := .Values.global -}}
+{{- range $idx, $preset := .Values.presets -}}
+{{-   range $key, $value := index $preset_values $preset -}}
+{{-     $_ := set $global $key $value -}}
+{{-   end -}}
+{{- end -}}
+{{- end -}}
+{{- define "merge_preset_values" -}}
+{{- $values := .Values -}}
+{{- range $idx, $preset := .Values.presets -}}
+{{-   $_ := mergeOverwrite $values (index $values.preset_values $preset) -}}
+{{- end -}}
+{{- end -}}
@@ -2,16 +2,89 @@ package output
 
 import (
 	"errors"
+	"fmt"
+	"iter"
 
 	"github.com/Mirantis/ktl/pkg/types"
 )
 
 const (
 	dirPerm = 0o700
+
+	defaultBasePath       types.PathTemplate = "base"
+	defaultComponentsPath types.PathTemplate = "components/${GROUP}"
+	defaultOverlaysPath   types.PathTemplate = "overlays/${CLUSTER}"
+	defaultChartPath      types.PathTemplate = "charts/${CHART}"
+	defaultValuesPath     types.PathTemplate = "values/${GROUP}.yaml"
 )
 
-var errMutuallyExclusive = errors.New("only one attribute allowed")
+var (
+	errMutuallyExclusive = errors.New("only one attribute allowed")
+	errDuplicatePath     = errors.New("same path for different clusters")
+)
 
 type Impl interface {
 	Store(env *types.Env, resources *types.ClusterResources) error
 }
+
+type Paths struct {
+	Base       types.PathTemplate `yaml:"base"`
+	Components types.PathTemplate `yaml:"components"`
+	Overlays   types.PathTemplate `yaml:"overlays"`
+	Chart      types.PathTemplate `yaml:"chart"`
+	Resources  types.PathTemplate `yaml:"resources"`
+	Values     types.PathTemplate `yaml:"values"`
+}
+
+func (paths Paths) withDefaults() Paths {
+	if paths.Base == "" {
+		paths.Base = defaultBasePath
+	}
+
+	if paths.Components == "" {
+		paths.Components = defaultComponentsPath
+	}
+
+	if paths.Overlays == "" {
+		paths.Overlays = defaultOverlaysPath
+	}
+
+	if paths.Chart == "" {
+		paths.Chart = defaultChartPath
+	}
+
+	if paths.Values == "" {
+		paths.Values = defaultValuesPath
+	}
+
+	return paths
+}
+
+// checkUniquePaths returns an error if the paths of the owners, e.g. cluster
+// overlays, are not distinct, the files of one owner would overwrite the
+// other.
+func checkUniquePaths(paths iter.Seq2[string, string]) error {
+	owners := map[string]string{}
+
+	for owner, path := range paths {
+		if other, found := owners[path]; found {
+			return fmt.Errorf("%w: %s for %s and %s", errDuplicatePath, path, other, owner)
+		}
+
+		owners[path] = owner
+	}
+
+	return nil
+}
+
+// checkOverlayPaths returns an error if the overlays of the clusters are not
+// distinct.
+func checkOverlayPaths(tmpl types.PathTemplate, clusters *types.ClusterIndex) error {
+	return checkUniquePaths(func(yield func(string, string) bool) {
+		for _, cluster := range clusters.All() {
+			if !yield(cluster.Name, tmpl.Expand(types.PathVars{Cluster: &cluster})) {
+				return
+			}
+		}
+	})
+}
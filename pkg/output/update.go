@@ -0,0 +1,459 @@
+package output
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// VersionBump defines how the chart version is incremented, when an existing
+// chart is updated.
+type VersionBump string
+
+const (
+	PatchBump VersionBump = "patch"
+	MinorBump VersionBump = "minor"
+	MajorBump VersionBump = "major"
+	NoBump    VersionBump = "none"
+)
+
+const (
+	// generatedFileName stores the hashes of the generated chart files, to
+	// tell them from the files edited by the user.
+	generatedFileName  = ".ktl-generated.yaml"
+	helmignoreFileName = ".helmignore"
+)
+
+var (
+	errUnsupportedVersionBump = errors.New("unsupported version bump")
+	errInvalidVersion         = errors.New("invalid chart version")
+
+	flatReferenceRegexp       = regexp.MustCompile(`index \.Values\.global ("(?:[^"\\]|\\.)*")`)
+	structuredReferenceRegexp = regexp.MustCompile(`\.Values((?:\.\w+)+)`)
+)
+
+func (bump *VersionBump) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid version bump: %w", err)
+	}
+
+	switch value := VersionBump(raw); value {
+	case "", PatchBump, MinorBump, MajorBump, NoBump:
+		*bump = value
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedVersionBump, raw)
+	}
+
+	return nil
+}
+
+// bumpVersion increments the semantic version, e.g. "v1.2" becomes "v1.2.1"
+// for the patch policy. Pre-release and build suffixes are dropped.
+func bumpVersion(version string, bump VersionBump) (string, error) {
+	if bump == NoBump {
+		return version, nil
+	}
+
+	prefix := ""
+	core := version
+
+	if strings.HasPrefix(core, "v") {
+		prefix, core = "v", core[1:]
+	}
+
+	core, _, _ = strings.Cut(core, "+")
+	core, _, _ = strings.Cut(core, "-")
+	parts := strings.Split(core, ".")
+
+	if len(parts) > 3 {
+		return "", fmt.Errorf("%w: %s", errInvalidVersion, version)
+	}
+
+	numbers := [3]int{}
+
+	for idx, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", errInvalidVersion, version)
+		}
+
+		numbers[idx] = number
+	}
+
+	switch bump {
+	case MajorBump:
+		numbers = [3]int{numbers[0] + 1, 0, 0}
+	case MinorBump:
+		numbers = [3]int{numbers[0], numbers[1] + 1, 0}
+	default:
+		numbers[2]++
+	}
+
+	return fmt.Sprintf("%s%d.%d.%d", prefix, numbers[0], numbers[1], numbers[2]), nil
+}
+
+type generatedFiles struct {
+	Files map[string]string `yaml:"files"`
+}
+
+func fileHash(body []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(body))
+}
+
+func readGeneratedFiles(fileSys filesys.FileSystem, dir string) (*generatedFiles, error) {
+	generated := &generatedFiles{Files: map[string]string{}}
+	path := filepath.Join(dir, generatedFileName)
+
+	if !fileSys.Exists(path) {
+		return generated, nil
+	}
+
+	body, err := fileSys.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(body, generated); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+
+	if generated.Files == nil {
+		generated.Files = map[string]string{}
+	}
+
+	return generated, nil
+}
+
+// fieldIndex returns the index of the mapping field key, or -1 if missing.
+func fieldIndex(node *yaml.Node, key string) int {
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// updateMapping updates the existing values with the generated ones. The
+// existing fields, that are not generated, are kept unless pruned.
+func updateMapping(dst, src *yaml.Node, prune bool) {
+	srcFields := mappingFields(src)
+
+	if prune {
+		content := []*yaml.Node{}
+
+		for i := 0; i < len(dst.Content); i += 2 {
+			if _, found := srcFields[dst.Content[i].Value]; found {
+				content = append(content, dst.Content[i], dst.Content[i+1])
+			}
+		}
+
+		dst.Content = content
+	}
+
+	for i := 0; i < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		idx := fieldIndex(dst, key.Value)
+
+		switch {
+		case idx < 0:
+			dst.Content = append(dst.Content, key, value)
+		case dst.Content[idx+1].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			updateMapping(dst.Content[idx+1], value, prune)
+		case nodeText(dst.Content[idx+1]) != nodeText(value):
+			dst.Content[idx+1] = value
+		}
+	}
+}
+
+// referencedValues returns the paths of the values referenced by the
+// template, relative to the preset values.
+func (chart *Chart) referencedValues(body []byte) [][]string {
+	paths := [][]string{}
+
+	if chart.Values == StructuredValues {
+		for _, match := range structuredReferenceRegexp.FindAllSubmatch(body, -1) {
+			paths = append(paths, strings.Split(string(match[1][1:]), "."))
+		}
+
+		return paths
+	}
+
+	for _, match := range flatReferenceRegexp.FindAllSubmatch(body, -1) {
+		if name, err := strconv.Unquote(string(match[1])); err == nil {
+			paths = append(paths, []string{name})
+		}
+	}
+
+	return paths
+}
+
+// lookupPath returns the node at the path of the mapping keys, if any.
+func lookupPath(node *yaml.Node, path []string) *yaml.Node {
+	for _, key := range path {
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		idx := fieldIndex(node, key)
+		if idx < 0 {
+			return nil
+		}
+
+		node = node.Content[idx+1]
+	}
+
+	return node
+}
+
+// setPath sets the node at the path of the mapping keys, the missing parent
+// mappings are created.
+func setPath(node *yaml.Node, path []string, value *yaml.Node) {
+	for _, key := range path[:len(path)-1] {
+		idx := fieldIndex(node, key)
+		if idx < 0 {
+			node.Content = append(node.Content, yaml.NewStringRNode(key).YNode(), &yaml.Node{Kind: yaml.MappingNode})
+			idx = len(node.Content) - 2
+		}
+
+		node = node.Content[idx+1]
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+	}
+
+	node.Content = append(node.Content, yaml.NewStringRNode(path[len(path)-1]).YNode(), value)
+}
+
+// updatePresets updates the existing preset values, the stale ones are
+// removed, unless referenced by the kept templates. The presets no longer
+// generated are not used by the clusters and are removed anyway.
+func updatePresets(presets, generated *yaml.Node, referenced [][]string) {
+	kept := map[string]*yaml.Node{}
+	paths := map[string][]string{}
+
+	for i := 0; i < len(presets.Content); i += 2 {
+		for _, ref := range referenced {
+			if value := lookupPath(presets.Content[i+1], ref); value != nil {
+				path := append([]string{presets.Content[i].Value}, ref...)
+				kept[strings.Join(path, "\n")] = value
+				paths[strings.Join(path, "\n")] = path
+			}
+		}
+	}
+
+	updateMapping(presets, generated, true)
+
+	for _, key := range slices.Sorted(maps.Keys(kept)) {
+		if lookupPath(presets, paths[key][:1]) != nil && lookupPath(presets, paths[key]) == nil {
+			setPath(presets, paths[key], kept[key])
+		}
+	}
+}
+
+// updateValues updates the generated values in the existing values.yaml, the
+// extra values are kept, the stale preset values are removed unless they are
+// referenced by the kept templates.
+func updateValues(existing []byte, generated *yaml.RNode, referenced [][]string) (*yaml.RNode, error) {
+	values, err := yaml.Parse(string(existing))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", valuesFileName, err)
+	}
+
+	if values.YNode().Kind != yaml.MappingNode {
+		return generated, nil
+	}
+
+	for i := 0; i < len(generated.YNode().Content); i += 2 {
+		key, value := generated.YNode().Content[i], generated.YNode().Content[i+1]
+		field := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{key, value}}
+
+		updateMapping(values.YNode(), field, false)
+
+		if key.Value == presetValuesKey {
+			if current := mappingFields(values.YNode())[presetValuesKey]; current.Kind == yaml.MappingNode {
+				updatePresets(current, value, referenced)
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// updateChartYAML keeps the existing Chart.yaml fields, the version is bumped
+// if the chart is changed.
+func (chart *Chart) updateChartYAML(existing []byte, changed bool) ([]byte, error) {
+	meta, err := yaml.Parse(string(existing))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", chartFileName, err)
+	}
+
+	version := chart.meta.Version
+	if field := meta.Field("version"); field != nil {
+		version = yaml.GetValue(field.Value)
+	}
+
+	if changed {
+		version, err = bumpVersion(version, chart.VersionBump)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chart.meta.Version = version
+
+	if err := meta.PipeE(yaml.SetField("version", yaml.NewStringRNode(version))); err != nil {
+		return nil, fmt.Errorf("unable to update %s: %w", chartFileName, err)
+	}
+
+	return []byte(meta.MustString()), nil
+}
+
+// helmignore returns the .helmignore excluding the generated files state
+// from the chart package.
+func helmignore(existing []byte) []byte {
+	for _, line := range strings.Split(string(existing), "\n") {
+		if strings.TrimSpace(line) == generatedFileName {
+			return existing
+		}
+	}
+
+	body := slices.Clone(existing)
+	if len(body) > 0 && !bytes.HasSuffix(body, []byte("\n")) {
+		body = append(body, '\n')
+	}
+
+	return append(body, generatedFileName+"\n"...)
+}
+
+// update returns the generated files merged with the existing chart: the
+// templates edited by the user and the extra values are kept, the stale
+// generated files are removed. The charts generated before the hashes were
+// stored are migrated, their files are regenerated.
+//
+//nolint:cyclop,gocognit
+func (chart *Chart) update(fileSys filesys.FileSystem, dir string, files map[string][]byte) (map[string][]byte, error) {
+	previous, err := readGeneratedFiles(fileSys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrate := !fileSys.Exists(filepath.Join(dir, generatedFileName)) && fileSys.Exists(filepath.Join(dir, chartFileName))
+	current := &generatedFiles{Files: map[string]string{}}
+	result := map[string][]byte{}
+	referenced := [][]string{}
+	changed := false
+
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		if path == chartFileName || path == valuesFileName {
+			continue
+		}
+
+		body := files[path]
+		existing, err := fileSys.ReadFile(filepath.Join(dir, path))
+
+		switch {
+		case err != nil:
+			result[path] = body
+			changed = true
+		case bytes.Equal(existing, body):
+		case migrate:
+			slog.Warn("replacing chart file generated without the hashes", "path", path)
+
+			result[path] = body
+			changed = true
+		case previous.Files[path] != fileHash(existing):
+			slog.Info("keeping edited chart file", "path", path)
+
+			if hash := previous.Files[path]; hash != "" {
+				current.Files[path] = hash
+			}
+
+			referenced = append(referenced, chart.referencedValues(existing)...)
+
+			continue
+		default:
+			result[path] = body
+			changed = true
+		}
+
+		current.Files[path] = fileHash(body)
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(previous.Files)) {
+		if _, found := files[path]; found {
+			continue
+		}
+
+		existing, err := fileSys.ReadFile(filepath.Join(dir, path))
+		if err != nil || fileHash(existing) != previous.Files[path] {
+			continue
+		}
+
+		if err := fileSys.RemoveAll(filepath.Join(dir, path)); err != nil {
+			return nil, fmt.Errorf("unable to remove stale %s: %w", path, err)
+		}
+
+		changed = true
+	}
+
+	if existing, err := fileSys.ReadFile(filepath.Join(dir, valuesFileName)); err == nil {
+		values, err := updateValues(existing, chart.valuesYAML(), referenced)
+		if err != nil {
+			return nil, err
+		}
+
+		if body := []byte(values.MustString()); !bytes.Equal(existing, body) {
+			result[valuesFileName] = body
+			changed = true
+		}
+	} else {
+		result[valuesFileName] = files[valuesFileName]
+	}
+
+	if existing, err := fileSys.ReadFile(filepath.Join(dir, chartFileName)); err == nil {
+		body, err := chart.updateChartYAML(existing, changed)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(existing, body) {
+			result[chartFileName] = body
+		}
+	} else {
+		result[chartFileName] = files[chartFileName]
+	}
+
+	body, err := yaml.Marshal(current)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate %s: %w", generatedFileName, err)
+	}
+
+	result[generatedFileName] = body
+
+	ignored, err := fileSys.ReadFile(filepath.Join(dir, helmignoreFileName))
+	if err != nil {
+		ignored = nil
+	}
+
+	if body := helmignore(ignored); !bytes.Equal(ignored, body) {
+		result[helmignoreFileName] = body
+	}
+
+	slog.Info("chart updated", "version", chart.meta.Version, "changed", changed)
+
+	return result, nil
+}
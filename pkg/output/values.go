@@ -0,0 +1,229 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Mirantis/ktl/pkg/resource"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/sets"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ValuesStyle defines how the chart variables are named in values.yaml.
+type ValuesStyle string
+
+const (
+	// FlatValues stores every variable under .Values.global, named after the
+	// resource ID and the path, e.g. "ns/Deployment/app.spec.replicas".
+	FlatValues ValuesStyle = "flat"
+	// StructuredValues stores variables as nested camelCase values, e.g.
+	// .Values.deployment.app.replicas.
+	StructuredValues ValuesStyle = "structured"
+)
+
+const (
+	presetsKey      = "presets"
+	presetValuesKey = "preset_values"
+	enabledKey      = "enabled"
+	clusterNameKey  = "clusterName"
+)
+
+var (
+	errUnsupportedValuesStyle = errors.New("unsupported values style")
+	errInvalidValueAlias      = errors.New("invalid value alias")
+
+	valueNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+func (style *ValuesStyle) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid values style: %w", err)
+	}
+
+	switch value := ValuesStyle(raw); value {
+	case "", FlatValues, StructuredValues:
+		*style = value
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedValuesStyle, raw)
+	}
+
+	return nil
+}
+
+// ValueAliases replace the prefixes of the structured value names, the
+// targets are dotted identifiers usable in .Values references.
+type ValueAliases map[string]string
+
+func (aliases *ValueAliases) UnmarshalYAML(node *yaml.Node) error {
+	var raw map[string]string
+	if err := node.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid value aliases: %w", err)
+	}
+
+	for prefix, target := range raw {
+		for _, element := range strings.Split(target, ".") {
+			if !valueNameRegexp.MatchString(element) {
+				return fmt.Errorf("%w: %s: %q", errInvalidValueAlias, prefix, target)
+			}
+		}
+	}
+
+	*aliases = raw
+
+	return nil
+}
+
+// valueNames generates unique structured value names.
+type valueNames struct {
+	aliases  map[string]string
+	leaves   sets.String
+	branches sets.String
+}
+
+func newValueNames(aliases map[string]string) *valueNames {
+	names := &valueNames{
+		aliases:  aliases,
+		leaves:   sets.String{},
+		branches: sets.String{},
+	}
+	names.leaves.Insert(presetsKey, presetValuesKey, enabledKey, clusterNameKey)
+
+	return names
+}
+
+// camelCase converts arbitrary keys, e.g. "simple-app" or
+// "app.kubernetes.io/name", into template-friendly identifiers.
+func camelCase(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	result := strings.Builder{}
+
+	for idx, word := range words {
+		runes := []rune(word)
+		if idx == 0 {
+			runes[0] = unicode.ToLower(runes[0])
+		} else {
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+
+		result.WriteString(string(runes))
+	}
+
+	if result.Len() == 0 {
+		return "value"
+	}
+
+	name := result.String()
+	if unicode.IsDigit([]rune(name)[0]) {
+		name = "_" + name
+	}
+
+	return name
+}
+
+func pathElementName(element string) string {
+	if !yaml.IsListIndex(element) {
+		return camelCase(element)
+	}
+
+	// [name=app] becomes "app", [a=x,b=y] becomes "xY"
+	conditions := strings.Split(strings.Trim(element, "[]"), ",")
+	values := make([]string, 0, len(conditions))
+
+	for _, condition := range conditions {
+		_, value, _ := strings.Cut(condition, "=")
+		values = append(values, value)
+	}
+
+	return camelCase(strings.Join(values, "-"))
+}
+
+// name returns a unique value name for the resource path, e.g.
+// "deployment.app.template.containers.app.image". The "spec" fields are
+// omitted, the longest matching alias prefix is replaced.
+func (names *valueNames) name(resID resid.ResId, path resource.Query, suffix ...string) string {
+	elements := []string{camelCase(resID.Kind), camelCase(resID.Name)}
+
+	for _, element := range path {
+		if element == "spec" {
+			continue
+		}
+
+		elements = append(elements, pathElementName(element))
+	}
+
+	elements = append(elements, suffix...)
+
+	return names.unique(names.alias(elements))
+}
+
+func (names *valueNames) alias(elements []string) []string {
+	for size := len(elements); size > 0; size-- {
+		target, found := names.aliases[strings.Join(elements[:size], ".")]
+		if !found {
+			continue
+		}
+
+		return append(strings.Split(target, "."), elements[size:]...)
+	}
+
+	return elements
+}
+
+// conflicts reports whether the name is already used by a value, or, for the
+// last path element, by a nested mapping.
+func (names *valueNames) conflicts(name string, last bool) bool {
+	return names.leaves.Has(name) || (last && names.branches.Has(name))
+}
+
+func (names *valueNames) unique(elements []string) string {
+	for idx := range elements {
+		last := idx == len(elements)-1
+		if !names.conflicts(strings.Join(elements[:idx+1], "."), last) {
+			continue
+		}
+
+		base := elements[idx]
+		for counter := 2; names.conflicts(strings.Join(elements[:idx+1], "."), last); counter++ {
+			elements[idx] = base + strconv.Itoa(counter)
+		}
+	}
+
+	for size := 1; size < len(elements); size++ {
+		names.branches.Insert(strings.Join(elements[:size], "."))
+	}
+
+	name := strings.Join(elements, ".")
+	names.leaves.Insert(name)
+
+	return name
+}
+
+// nestedValues converts the dotted structured names into nested mappings.
+func nestedValues(values chartValues) *yaml.RNode {
+	root := yaml.NewMapRNode(nil)
+
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		path := strings.Split(name, ".")
+		parent, err := root.Pipe(yaml.LookupCreate(yaml.MappingNode, path[:len(path)-1]...))
+		if err != nil {
+			panic(err)
+		}
+
+		if err := parent.PipeE(yaml.SetField(path[len(path)-1], yaml.NewRNode(values[name]))); err != nil {
+			panic(err)
+		}
+	}
+
+	return root
+}
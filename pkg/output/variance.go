@@ -0,0 +1,299 @@
+package output
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Mirantis/ktl/pkg/resource"
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/openapi"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ReportFormat defines how the variance report is written.
+type ReportFormat string
+
+const (
+	MarkdownReport ReportFormat = "markdown"
+	JSONReport     ReportFormat = "json"
+	TableReport    ReportFormat = "table"
+)
+
+var errUnsupportedReportFormat = errors.New("unsupported report format")
+
+func (format *ReportFormat) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid report format: %w", err)
+	}
+
+	switch value := ReportFormat(raw); value {
+	case "", MarkdownReport, JSONReport, TableReport:
+		*format = value
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedReportFormat, raw)
+	}
+
+	return nil
+}
+
+// reportPaths are the default report paths of the formats.
+var reportPaths = map[ReportFormat]string{
+	"":             "variance.md",
+	MarkdownReport: "variance.md",
+	JSONReport:     "variance.json",
+	TableReport:    "variance.txt",
+}
+
+// VarianceReportOutput lists the resource fields differing across the
+// clusters, the most fragmented first. The report is written to
+// "variance.md", "variance.json" or "variance.txt" by default.
+type VarianceReportOutput struct {
+	Path   string       `yaml:"path"`
+	Format ReportFormat `yaml:"format"`
+}
+
+// FieldVariant is a value of the field and the clusters holding it, named
+// after their group, e.g. "prod". Missing variants hold no value.
+type FieldVariant struct {
+	Value    string   `json:"value,omitempty"`
+	Missing  bool     `json:"missing,omitempty"`
+	Group    string   `json:"group"`
+	Clusters []string `json:"clusters"`
+}
+
+// FieldVariance lists the variants of a resource field, the score is the
+// probability that two random clusters hold different variants, rounded to
+// two digits.
+type FieldVariance struct {
+	Resource string         `json:"resource"`
+	Path     string         `json:"path"`
+	Score    float64        `json:"score"`
+	Variants []FieldVariant `json:"variants"`
+}
+
+func varianceScore(variants []FieldVariant) float64 {
+	total := 0
+	for _, variant := range variants {
+		total += len(variant.Clusters)
+	}
+
+	score := 1.0
+
+	for _, variant := range variants {
+		share := float64(len(variant.Clusters)) / float64(total)
+		score -= share * share
+	}
+
+	return math.Round(score*100) / 100 //nolint:mnd
+}
+
+func variantValue(node *yaml.Node) string {
+	text, err := yaml.String(node, yaml.Flow)
+	if err != nil {
+		return node.Value
+	}
+
+	return strings.TrimSpace(text)
+}
+
+// fieldVariants groups the clusters by the field value, the clusters of the
+// parent node without the field hold the missing variant.
+func fieldVariants(clusters *types.ClusterIndex, values []*resource.ValueGroup, parent []types.ClusterID) []FieldVariant {
+	variants := []FieldVariant{}
+	present := map[types.ClusterID]bool{}
+
+	for _, group := range values {
+		variants = append(variants, FieldVariant{
+			Value:    variantValue(group.Value),
+			Group:    clusters.Group(group.Clusters...),
+			Clusters: slices.Collect(clusters.Names(group.Clusters...)),
+		})
+
+		for _, clusterID := range group.Clusters {
+			present[clusterID] = true
+		}
+	}
+
+	missing := []types.ClusterID{}
+
+	for _, clusterID := range parent {
+		if !present[clusterID] {
+			missing = append(missing, clusterID)
+		}
+	}
+
+	if len(missing) > 0 {
+		variants = append(variants, FieldVariant{
+			Missing:  true,
+			Group:    clusters.Group(missing...),
+			Clusters: slices.Collect(clusters.Names(missing...)),
+		})
+	}
+
+	return variants
+}
+
+// resourceVariance returns the varying fields of the resource. The subtrees
+// missing in some clusters are reported as a whole.
+func resourceVariance(clusters *types.ClusterIndex, resID resid.ResId, byCluster map[types.ClusterID]*yaml.RNode) ([]FieldVariance, error) {
+	report := []FieldVariance{}
+	resIterator := resource.NewIterator(byCluster, openapi.SchemaForResourceType(resID.AsTypeMeta()))
+	// the clusters holding the parents of the current path
+	holders := [][]types.ClusterID{clusters.IDs()}
+
+	for resIterator.Next() {
+		path := resIterator.Path()
+		current := resIterator.Clusters()
+		holders = append(holders[:len(path)+1], current)
+		parent := holders[len(path)]
+
+		var variants []FieldVariant
+
+		switch {
+		case resIterator.IsValue():
+			variants = fieldVariants(clusters, resource.GroupByValue(resIterator.Values()), parent)
+		case len(current) == len(parent):
+			continue
+		case len(path) > 0:
+			resIterator.Skip()
+
+			variants = fieldVariants(clusters, resource.GroupByValue(resIterator.Nodes()), parent)
+		default:
+			// the resource is missing in some clusters
+			variants = fieldVariants(clusters, resource.GroupByValue(resIterator.Values()), parent)
+			variants[0].Value = "present"
+		}
+
+		if len(variants) < 2 { //nolint:mnd
+			continue
+		}
+
+		report = append(report, FieldVariance{
+			Resource: resID.String(),
+			Path:     path.String(),
+			Score:    varianceScore(variants),
+			Variants: variants,
+		})
+	}
+
+	if err := resIterator.Error(); err != nil {
+		return nil, fmt.Errorf("unable to collect variants of %s: %w", resID, err)
+	}
+
+	return report, nil
+}
+
+// Variance returns the varying fields of all resources, sorted by the score.
+func Variance(resources *types.ClusterResources) ([]FieldVariance, error) {
+	report := []FieldVariance{}
+
+	for resID, byCluster := range resources.Resources {
+		variance, err := resourceVariance(resources.Clusters, resID, byCluster)
+		if err != nil {
+			return nil, err
+		}
+
+		report = append(report, variance...)
+	}
+
+	slices.SortFunc(report, func(a, b FieldVariance) int {
+		return cmp.Or(
+			cmp.Compare(b.Score, a.Score),
+			strings.Compare(a.Resource, b.Resource),
+			strings.Compare(a.Path, b.Path),
+		)
+	})
+
+	return report, nil
+}
+
+func (variant FieldVariant) text() string {
+	if variant.Missing {
+		return "(missing)"
+	}
+
+	return variant.Value
+}
+
+func markdownCell(text string) string {
+	return strings.ReplaceAll(text, "|", `\|`)
+}
+
+func markdownReport(report []FieldVariance) []byte {
+	text := &strings.Builder{}
+	text.WriteString("| Resource | Path | Score | Variants |\n")
+	text.WriteString("|---|---|---|---|\n")
+
+	for _, field := range report {
+		variants := []string{}
+		for _, variant := range field.Variants {
+			variants = append(variants, fmt.Sprintf("`%s`: %s", variant.text(), variant.Group))
+		}
+
+		fmt.Fprintf(text, "| %s | %s | %.2f | %s |\n",
+			markdownCell(field.Resource),
+			markdownCell(field.Path),
+			field.Score,
+			markdownCell(strings.Join(variants, "<br>")),
+		)
+	}
+
+	return []byte(text.String())
+}
+
+func tableReport(report []FieldVariance) ([]byte, error) {
+	rows := [][]string{{"RESOURCE", "PATH", "SCORE", "VARIANT", "GROUP"}}
+
+	for _, field := range report {
+		for _, variant := range field.Variants {
+			rows = append(rows, []string{
+				field.Resource,
+				field.Path,
+				strconv.FormatFloat(field.Score, 'f', 2, 64),
+				variant.text(),
+				variant.Group,
+			})
+		}
+	}
+
+	return writeTable(rows)
+}
+
+func (out *VarianceReportOutput) Store(env *types.Env, resources *types.ClusterResources) error {
+	path := withDefault(out.Path, reportPaths[out.Format])
+	if filepath.IsAbs(path) {
+		return fmt.Errorf("invalid report output path: %w", errAbsPath)
+	}
+
+	report, err := Variance(resources)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+
+	switch out.Format {
+	case JSONReport:
+		body, err = json.MarshalIndent(report, "", "  ")
+		body = append(body, '\n')
+	case TableReport:
+		body, err = tableReport(report)
+	default:
+		body = markdownReport(report)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to generate the report: %w", err)
+	}
+
+	return env.FileSys.WriteFile(path, body) //nolint:wrapcheck
+}
@@ -0,0 +1,117 @@
+package output_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestVarianceReport(t *testing.T) {
+	tests := map[output.ReportFormat]string{
+		output.MarkdownReport: "| Resource | Path | Score | Variants |\n" +
+			"|---|---|---|---|\n" +
+			"| Deployment.v1.apps/myapp.myapp | metadata.labels.env | 0.64 | `prod`: prod<br>`test`: test<br>`dev`: dev |\n" +
+			"| Deployment.v1.apps/myapp.myapp | spec.replicas | 0.56 | `3`: prod-a<br>`5`: prod-b<br>`(missing)`: test_dev |\n" +
+			"| Deployment.v1.apps/myapp.myapp | spec.template.spec.containers.[name=myapp].args | 0.32 " +
+			"| `[\"--debug\"]`: dev<br>`(missing)`: prod_test |\n" +
+			"| Deployment.v1.apps/myapp.myapp | spec.template.spec.containers.[name=myapp].image | 0.32 " +
+			"| `myapp:v1.1`: prod_test<br>`myapp:v1.2-345`: dev |\n",
+		output.TableReport: `RESOURCE                         PATH                                               SCORE   VARIANT           GROUP
+Deployment.v1.apps/myapp.myapp   metadata.labels.env                                0.64    prod              prod
+Deployment.v1.apps/myapp.myapp   metadata.labels.env                                0.64    test              test
+Deployment.v1.apps/myapp.myapp   metadata.labels.env                                0.64    dev               dev
+Deployment.v1.apps/myapp.myapp   spec.replicas                                      0.56    3                 prod-a
+Deployment.v1.apps/myapp.myapp   spec.replicas                                      0.56    5                 prod-b
+Deployment.v1.apps/myapp.myapp   spec.replicas                                      0.56    (missing)         test_dev
+Deployment.v1.apps/myapp.myapp   spec.template.spec.containers.[name=myapp].args    0.32    "[""--debug""]"   dev
+Deployment.v1.apps/myapp.myapp   spec.template.spec.containers.[name=myapp].args    0.32    (missing)         prod_test
+Deployment.v1.apps/myapp.myapp   spec.template.spec.containers.[name=myapp].image   0.32    myapp:v1.1        prod_test
+Deployment.v1.apps/myapp.myapp   spec.template.spec.containers.[name=myapp].image   0.32    myapp:v1.2-345    dev
+`,
+	}
+
+	for format, want := range tests {
+		t.Run(string(format), func(t *testing.T) {
+			env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+			out := &output.VarianceReportOutput{Path: "report", Format: format}
+
+			if err := out.Store(env, verifyResources()); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := env.FileSys.ReadFile("report")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(want, string(got)); diff != "" {
+				t.Errorf("report mismatch, +got -want:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVarianceReportDefaultPath(t *testing.T) {
+	tests := map[output.ReportFormat]string{
+		"":                 "variance.md",
+		output.JSONReport:  "variance.json",
+		output.TableReport: "variance.txt",
+	}
+
+	for format, path := range tests {
+		t.Run(path, func(t *testing.T) {
+			env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+			out := &output.VarianceReportOutput{Format: format}
+
+			if err := out.Store(env, verifyResources()); err != nil {
+				t.Fatal(err)
+			}
+
+			if !env.FileSys.Exists(path) {
+				t.Errorf("report %s not found", path)
+			}
+		})
+	}
+}
+
+func TestVarianceReportJSON(t *testing.T) {
+	env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+	out := &output.VarianceReportOutput{Path: "report.json", Format: output.JSONReport}
+
+	if err := out.Store(env, verifyResources()); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := env.FileSys.ReadFile("report.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := []output.FieldVariance{}
+	if err := json.Unmarshal(body, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	want := output.FieldVariance{
+		Resource: "Deployment.v1.apps/myapp.myapp",
+		Path:     "spec.replicas",
+		Score:    0.56,
+		Variants: []output.FieldVariant{
+			{Value: "3", Group: "prod-a", Clusters: []string{"prod-a"}},
+			{Value: "5", Group: "prod-b", Clusters: []string{"prod-b"}},
+			{Missing: true, Group: "test_dev", Clusters: []string{"dev-a", "test-a", "test-b"}},
+		},
+	}
+
+	if len(report) != 4 {
+		t.Fatalf("want 4 varying fields, got %d", len(report))
+	}
+
+	if diff := cmp.Diff(want, report[1]); diff != "" {
+		t.Errorf("field variance mismatch, +got -want:\n%s", diff)
+	}
+}
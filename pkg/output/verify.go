@@ -0,0 +1,214 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+var (
+	ErrVerifyUnsupported = errors.New("output does not support verification")
+	errVerifyMismatch    = errors.New("rendered output does not match the input")
+)
+
+// Renderer is implemented by the outputs able to render the stored manifests
+// back for every cluster.
+type Renderer interface {
+	Render(env *types.Env, clusters *types.ClusterIndex) (map[types.ClusterID][]*yaml.RNode, error)
+}
+
+// Verify renders the stored output and compares it with the resources of
+// every cluster.
+func Verify(env *types.Env, impl Impl, resources *types.ClusterResources) error {
+	renderer, ok := impl.(Renderer)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrVerifyUnsupported, impl)
+	}
+
+	rendered, err := renderer.Render(env, resources.Clusters)
+	if err != nil {
+		return fmt.Errorf("unable to render output: %w", err)
+	}
+
+	diffs := []string{}
+
+	for clusterID, cluster := range resources.Clusters.All() {
+		got := map[resid.ResId]*yaml.RNode{}
+		for _, node := range rendered[clusterID] {
+			got[resid.FromRNode(node)] = node
+		}
+
+		for _, diff := range diffResources(cluster.Name, maps.Collect(resources.Cluster(clusterID)), got) {
+			prefix := diff.Cluster + ": " + diff.Resource
+
+			switch diff.Status {
+			case DriftMissing:
+				diffs = append(diffs, prefix+": missing")
+			case DriftExtra:
+				diffs = append(diffs, prefix+": unexpected")
+			case DriftModified:
+				for _, field := range diff.Fields {
+					diffs = append(diffs, fmt.Sprintf("%s: %s: %s", prefix, field.Path, field.Message))
+				}
+			}
+		}
+	}
+
+	if len(diffs) > 0 {
+		return fmt.Errorf("%w:\n%s", errVerifyMismatch, strings.Join(diffs, "\n"))
+	}
+
+	return nil
+}
+
+func childPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func decodeScalar(node *yaml.Node) any {
+	var value any
+	if err := node.Decode(&value); err != nil {
+		return node.Value
+	}
+
+	return value
+}
+
+func compareNodes(path string, want, got *yaml.Node, report func(path, msg string)) {
+	if want.Kind != got.Kind {
+		report(path, fmt.Sprintf("want %s, got %s", nodeText(want), nodeText(got)))
+
+		return
+	}
+
+	switch want.Kind {
+	case yaml.MappingNode:
+		wantFields, gotFields := mappingFields(want), mappingFields(got)
+		keys := slices.Sorted(maps.Keys(wantFields))
+
+		for key := range gotFields {
+			if _, found := wantFields[key]; !found {
+				keys = append(keys, key)
+			}
+		}
+
+		for _, key := range keys {
+			wantValue, gotValue := wantFields[key], gotFields[key]
+
+			switch {
+			case gotValue == nil:
+				report(childPath(path, key), "missing")
+			case wantValue == nil:
+				report(childPath(path, key), "unexpected "+nodeText(gotValue))
+			default:
+				compareNodes(childPath(path, key), wantValue, gotValue, report)
+			}
+		}
+	case yaml.SequenceNode:
+		if len(want.Content) != len(got.Content) {
+			report(path, fmt.Sprintf("want %d elements, got %d", len(want.Content), len(got.Content)))
+
+			return
+		}
+
+		for idx := range want.Content {
+			compareNodes(path+"["+strconv.Itoa(idx)+"]", want.Content[idx], got.Content[idx], report)
+		}
+	default:
+		if !reflect.DeepEqual(decodeScalar(want), decodeScalar(got)) {
+			report(path, fmt.Sprintf("want %s, got %s", nodeText(want), nodeText(got)))
+		}
+	}
+}
+
+func mappingFields(node *yaml.Node) map[string]*yaml.Node {
+	fields := map[string]*yaml.Node{}
+	for i := 0; i < len(node.Content); i += 2 {
+		fields[node.Content[i].Value] = node.Content[i+1]
+	}
+
+	return fields
+}
+
+func nodeText(node *yaml.Node) string {
+	text, err := yaml.String(node, yaml.Flow)
+	if err != nil {
+		return node.Value
+	}
+
+	return strings.TrimSpace(text)
+}
+
+func kustomizeBuild(fileSys filesys.FileSystem, dir string) ([]*yaml.RNode, error) {
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+
+	resMap, err := kustomizer.Run(fileSys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build %s: %w", dir, err)
+	}
+
+	return resMap.ToRNodeSlice(), nil
+}
+
+func (out *KustomizeOutput) Render(env *types.Env, clusters *types.ClusterIndex) (map[types.ClusterID][]*yaml.RNode, error) {
+	result := map[types.ClusterID][]*yaml.RNode{}
+
+	if !out.PerCluster {
+		nodes, err := kustomizeBuild(env.FileSys, ".")
+		if err != nil {
+			return nil, err
+		}
+
+		for clusterID := range clusters.All() {
+			result[clusterID] = nodes
+		}
+
+		return result, nil
+	}
+
+	clusterPath := out.Paths.Overlays
+	if clusterPath == "" {
+		clusterPath = defaultClusterPath
+	}
+
+	for clusterID, cluster := range clusters.All() {
+		nodes, err := kustomizeBuild(env.FileSys, clusterPath.Expand(types.PathVars{Cluster: &cluster}))
+		if err != nil {
+			return nil, err
+		}
+
+		result[clusterID] = nodes
+	}
+
+	return result, nil
+}
+
+func (out *ComponentsOutput) Render(env *types.Env, clusters *types.ClusterIndex) (map[types.ClusterID][]*yaml.RNode, error) {
+	paths := out.Paths.withDefaults()
+	result := map[types.ClusterID][]*yaml.RNode{}
+
+	for clusterID, cluster := range clusters.All() {
+		nodes, err := kustomizeBuild(env.FileSys, paths.Overlays.Expand(types.PathVars{Cluster: &cluster}))
+		if err != nil {
+			return nil, err
+		}
+
+		result[clusterID] = nodes
+	}
+
+	return result, nil
+}
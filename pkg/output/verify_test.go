@@ -0,0 +1,315 @@
+package output_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func verifyResources() *types.ClusterResources {
+	clusters := types.NewClusterIndex()
+	devA := clusters.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := clusters.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	prodB := clusters.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod"}})
+	testA := clusters.Add(types.Cluster{Name: "test-a", Tags: []string{"test"}})
+	testB := clusters.Add(types.Cluster{Name: "test-b", Tags: []string{"test"}})
+	byCluster := map[types.ClusterID]*yaml.RNode{
+		devA:  yaml.MustParse(appDevA),
+		prodA: yaml.MustParse(appProdA),
+		prodB: yaml.MustParse(appProdB),
+		testA: yaml.MustParse(appTestA),
+		testB: yaml.MustParse(appTestB),
+	}
+
+	return &types.ClusterResources{
+		Clusters: clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{
+			resid.FromRNode(byCluster[devA]): byCluster,
+		},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	chartMeta := types.HelmChart{Name: "myapp", Version: "v0.1"}
+	tests := map[string]output.Impl{
+		"components":          &output.ComponentsOutput{},
+		"components-json6902": &output.ComponentsOutput{Layout: output.LayeredLayout, Patches: output.JSON6902Patch},
+		"kustomize":           &output.KustomizeOutput{PerCluster: true},
+		"chart":               &output.ChartOutput{HelmChart: chartMeta},
+		"chart-structured": &output.ChartOutput{
+			HelmChart:         chartMeta,
+			Values:            output.StructuredValues,
+			CollapseThreshold: 0.5,
+		},
+		"chart-helmfile": &output.ChartOutput{HelmChart: chartMeta, OverlayStyle: output.HelmfileOverlays},
+	}
+
+	for name, impl := range tests {
+		t.Run(name, func(t *testing.T) {
+			resources := verifyResources()
+			env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+
+			if err := impl.Store(env, resources); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := output.Verify(env, impl, resources); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// generatedFleet returns a Deployment, which fields are randomly set, empty
+// or missing on the tagged clusters.
+func generatedFleet(seed uint64) *types.ClusterResources {
+	rnd := rand.New(rand.NewPCG(seed, 0)) //nolint:gosec
+	pick := func(values ...string) string { return values[rnd.IntN(len(values))] }
+	clusters := types.NewClusterIndex()
+	byCluster := map[types.ClusterID]*yaml.RNode{}
+
+	for idx := range 3 + rnd.IntN(4) {
+		tags := []string{}
+
+		for _, tag := range []string{"eu", "prod", "test"} {
+			if rnd.IntN(2) == 0 {
+				tags = append(tags, tag)
+			}
+		}
+
+		lines := []string{"apiVersion: apps/v1", "kind: Deployment", "metadata:", "  name: myapp", "  namespace: myapp"}
+
+		switch pick("missing", "empty", "set") {
+		case "empty":
+			lines = append(lines, "  labels: {}")
+		case "set":
+			lines = append(lines, "  labels:", "    a: "+pick("x", "y"), "    b: "+pick("x", "y"))
+		}
+
+		lines = append(lines, "spec:")
+
+		if replicas := pick("", "1", "1000000"); replicas != "" {
+			lines = append(lines, "  replicas: "+replicas)
+		}
+
+		lines = append(lines, "  template:", "    spec:", "      containers:", "      - name: myapp")
+		lines = append(lines, "        image: myapp:"+pick("v1", "v2"))
+
+		switch pick("missing", "empty", "set") {
+		case "empty":
+			lines = append(lines, "        env: []")
+		case "set":
+			lines = append(lines, "        env:", "        - name: MODE", "          value: "+pick("a", "b"))
+		}
+
+		clusterID := clusters.Add(types.Cluster{Name: fmt.Sprintf("cluster-%d", idx), Tags: tags})
+		byCluster[clusterID] = yaml.MustParse(strings.Join(lines, "\n"))
+	}
+
+	return &types.ClusterResources{
+		Clusters: clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{
+			resid.FromRNode(byCluster[0]): byCluster,
+		},
+	}
+}
+
+func TestVerifyGeneratedFleets(t *testing.T) {
+	chartMeta := types.HelmChart{Name: "myapp", Version: "v0.1"}
+	tests := map[string]output.Impl{
+		"greedy":           &output.ComponentsOutput{},
+		"layered":          &output.ComponentsOutput{Layout: output.LayeredLayout, Base: true},
+		"greedy-json6902":  &output.ComponentsOutput{Patches: output.JSON6902Patch},
+		"layered-json6902": &output.ComponentsOutput{Layout: output.LayeredLayout, Patches: output.JSON6902Patch},
+		"kustomize":        &output.KustomizeOutput{PerCluster: true},
+		"chart":            &output.ChartOutput{HelmChart: chartMeta},
+		"chart-structured": &output.ChartOutput{HelmChart: chartMeta, Values: output.StructuredValues},
+		"chart-helmfile":   &output.ChartOutput{HelmChart: chartMeta, OverlayStyle: output.HelmfileOverlays},
+		"chart-values":     &output.ChartOutput{HelmChart: chartMeta, OverlayStyle: output.ValuesOverlays},
+	}
+
+	for name, impl := range tests {
+		t.Run(name, func(t *testing.T) {
+			for seed := range uint64(20) {
+				resources := generatedFleet(seed)
+				env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+
+				if err := impl.Store(env, resources); err != nil {
+					t.Fatalf("fleet %d: %v", seed, err)
+				}
+
+				if err := output.Verify(env, impl, resources); err != nil {
+					t.Errorf("fleet %d: %v", seed, err)
+				}
+			}
+		})
+	}
+}
+
+type fleetCluster struct {
+	tags   []string
+	fields string
+}
+
+// configMapFleet returns a ConfigMap with the fields of every cluster.
+func configMapFleet(fleet []fleetCluster) *types.ClusterResources {
+	clusters := types.NewClusterIndex()
+	byCluster := map[types.ClusterID]*yaml.RNode{}
+
+	for idx, cluster := range fleet {
+		clusterID := clusters.Add(types.Cluster{Name: fmt.Sprintf("cluster-%d", idx), Tags: cluster.tags})
+		byCluster[clusterID] = yaml.MustParse("apiVersion: v1\nkind: ConfigMap\n" + cluster.fields)
+	}
+
+	return &types.ClusterResources{
+		Clusters: clusters,
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{
+			resid.FromRNode(byCluster[0]): byCluster,
+		},
+	}
+}
+
+func TestVerifyComponentsJSON6902(t *testing.T) {
+	tests := map[string][]fleetCluster{
+		"missing-labels": {
+			{fields: "metadata: {name: myapp, labels: {a: x}}"},
+			{fields: "metadata: {name: myapp, labels: {a: y}}"},
+			{fields: "metadata: {name: myapp, labels: {a: y}}"},
+			{fields: "metadata: {name: myapp}"},
+		},
+		"missing-label": {
+			{fields: "metadata: {name: myapp, labels: {a: y}}"},
+			{fields: "metadata: {name: myapp, labels: {a: y}}"},
+			{fields: "metadata: {name: myapp, labels: {a: y}}"},
+			{fields: "metadata: {name: myapp, labels: {b: z}}"},
+		},
+		"no-ops": {
+			{fields: "metadata: {name: myapp, labels: {a: x}}"},
+			{fields: "metadata: {name: myapp, labels: {a: x}}"},
+			{fields: "metadata: {name: myapp, labels: {a: x}}"},
+			{fields: "metadata: {name: myapp, labels: {a: x}}"},
+			{fields: "metadata: {name: myapp, labels: {a: x}}"},
+			{fields: "metadata: {name: myapp, labels: {}}"},
+			{fields: "metadata: {name: myapp, labels: {}}"},
+		},
+		"tagged-no-ops": {
+			{tags: []string{"p"}, fields: "metadata: {name: myapp, labels: {a: x}}"},
+			{tags: []string{"p"}, fields: "metadata: {name: myapp, labels: {a: x}}"},
+			{tags: []string{"p"}, fields: "metadata: {name: myapp}"},
+			{tags: []string{"t"}, fields: "metadata: {name: myapp}\ndata: {k: w}"},
+		},
+	}
+
+	for name, fleet := range tests {
+		t.Run(name, func(t *testing.T) {
+			resources := configMapFleet(fleet)
+			env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+			impl := &output.ComponentsOutput{Layout: output.LayeredLayout, Patches: output.JSON6902Patch}
+
+			if err := impl.Store(env, resources); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := output.Verify(env, impl, resources); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	resources := verifyResources()
+	env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+	impl := &output.ComponentsOutput{}
+
+	if err := impl.Store(env, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	path := "components/prod-a/myapp/myapp-deployment.yaml"
+
+	body, err := env.FileSys.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body = []byte(strings.ReplaceAll(string(body), "replicas: 3", "replicas: 4"))
+	if err := env.FileSys.WriteFile(path, body); err != nil {
+		t.Fatal(err)
+	}
+
+	err = output.Verify(env, impl, resources)
+	if err == nil {
+		t.Fatal("mismatch not detected")
+	}
+
+	want := "prod-a: Deployment.v1.apps/myapp.myapp: spec.replicas: want 3, got 4"
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := output.Verify(env, &output.TableOutput{}, resources); !errors.Is(err, output.ErrVerifyUnsupported) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVerifyChartTemplates(t *testing.T) {
+	resources := verifyResources()
+	configMap := yaml.MustParse(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myapp-env
+  namespace: myapp
+data:
+  MISSING: ""
+`)
+	byCluster := map[types.ClusterID]*yaml.RNode{}
+
+	for _, id := range resources.Clusters.IDs() {
+		byCluster[id] = configMap.Copy()
+	}
+
+	resources.Resources[resid.FromRNode(configMap)] = byCluster
+	env := &types.Env{FileSys: filesys.MakeFsInMemory()}
+	impl := &output.ChartOutput{HelmChart: types.HelmChart{Name: "myapp", Version: "v0.1"}}
+
+	if err := impl.Store(env, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	path := "charts/myapp/templates/myapp-env-configmap.yaml"
+
+	body, err := env.FileSys.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// missing values are rendered as empty strings, same as helm does
+	missing := []byte(strings.ReplaceAll(string(body), `MISSING: ""`, `MISSING: "{{ .Values.missing }}"`))
+	if err := env.FileSys.WriteFile(path, missing); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := output.Verify(env, impl, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	// helm functions not implemented by the renderer are not ignored
+	unknown := []byte(strings.ReplaceAll(string(body), `MISSING: ""`, `MISSING: {{ default "" .Values.missing }}`))
+	if err := env.FileSys.WriteFile(path, unknown); err != nil {
+		t.Fatal(err)
+	}
+
+	err = output.Verify(env, impl, resources)
+	if err == nil || !strings.Contains(err.Error(), `function "default" not defined`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"errors"
 	"fmt"
 	"slices"
 
@@ -8,6 +9,8 @@ import (
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
+var errNodeNotCreated = errors.New("unable to create resource attribute")
+
 type Builder struct {
 	path  Query
 	nodes []*yaml.RNode
@@ -72,6 +75,10 @@ func (b *Builder) Add(path Query, kind yaml.Kind) (*yaml.RNode, error) {
 		return nil, fmt.Errorf("unable to add resource attribute: %w", err)
 	}
 
+	if resNode == nil {
+		return nil, fmt.Errorf("%w: %s", errNodeNotCreated, path)
+	}
+
 	b.nodes[len(path)] = resNode
 
 	return resNode, nil
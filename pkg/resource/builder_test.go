@@ -65,3 +65,16 @@ x:
 		t.Errorf("miss (+got -want): %s", diff)
 	}
 }
+
+func TestBuilderNullParent(t *testing.T) {
+	builder := resource.NewNodeBuilder(yaml.NewMapRNode(nil))
+	null := &yaml.Node{Kind: yaml.ScalarNode, Tag: yaml.NodeTagNull, Value: "null"}
+
+	if _, err := builder.Set(resource.Query{"a"}, null); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builder.Set(resource.Query{"a", "b"}, yaml.NewStringRNode("v").YNode()); err == nil {
+		t.Error("want err, got none")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"iter"
+	"maps"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/Mirantis/ktl/pkg/types"
@@ -23,26 +25,32 @@ type FileStore struct {
 }
 
 func (store *FileStore) WriteAll(nodes iter.Seq2[resid.ResId, *yaml.RNode]) error {
-	buf := &bytes.Buffer{}
+	files := map[string][]*yaml.RNode{}
+	ids := map[*yaml.RNode]string{}
 
 	for resID, resNode := range nodes {
 		path := store.NameGenerator(resID)
+		files[path] = append(files[path], resNode)
+		ids[resNode] = resID.String()
+	}
+
+	buf := &bytes.Buffer{}
+
+	for _, path := range slices.Sorted(maps.Keys(files)) {
 		if err := store.MkdirAll(filepath.Dir(path)); err != nil {
 			return fmt.Errorf("unable to initialize dir for %v: %w", path, err)
 		}
 
-		buf.Reset()
-
-		err := kio.ByteWriter{
-			Writer: buf,
+		resNodes := files[path]
+		slices.SortFunc(resNodes, func(a, b *yaml.RNode) int {
+			return strings.Compare(ids[a], ids[b])
+		})
 
-			ClearAnnotations: []string{kioutil.PathAnnotation},
-		}.Write([]*yaml.RNode{resNode})
+		body, err := serialize(buf, resNodes)
 		if err != nil {
 			return fmt.Errorf("unable to serialize %v: %w", path, err)
 		}
 
-		body := buf.Bytes()
 		if store.PostProcessor != nil {
 			body = store.PostProcessor(path, body)
 		}
@@ -55,6 +63,32 @@ func (store *FileStore) WriteAll(nodes iter.Seq2[resid.ResId, *yaml.RNode]) erro
 	return nil
 }
 
+// serialize writes resources as a multi-document file. A single non-mapping
+// node, e.g. a JSON patch, is written as is.
+func serialize(buf *bytes.Buffer, resNodes []*yaml.RNode) ([]byte, error) {
+	buf.Reset()
+
+	if len(resNodes) == 1 && resNodes[0].YNode().Kind != yaml.MappingNode {
+		text, err := resNodes[0].String()
+		if err != nil {
+			return nil, fmt.Errorf("unable to serialize node: %w", err)
+		}
+
+		return []byte(text), nil
+	}
+
+	err := kio.ByteWriter{
+		Writer: buf,
+
+		ClearAnnotations: []string{kioutil.PathAnnotation},
+	}.Write(resNodes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write nodes: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
 func (store *FileStore) WriteKustomization(kust *types.Kustomization) error {
 	kustBytes, err := yaml.Marshal(kust)
 	if err != nil {
@@ -83,3 +117,16 @@ func FileName(resID resid.ResId) string {
 
 	return filepath.Join(parts...)
 }
+
+func FileNameTemplate(tmpl types.PathTemplate, vars types.PathVars) func(resid.ResId) string {
+	if tmpl == "" {
+		return FileName
+	}
+
+	return func(resID resid.ResId) string {
+		resVars := vars
+		resVars.ResID = &resID
+
+		return tmpl.Expand(resVars)
+	}
+}
@@ -0,0 +1,59 @@
+package resource_test
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/Mirantis/ktl/pkg/resource"
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestFileStoreTemplate(t *testing.T) {
+	nodes := map[resid.ResId]*yaml.RNode{}
+
+	for _, text := range []string{
+		"apiVersion: v1\nkind: ConfigMap\nmetadata: {name: b, namespace: app}\n",
+		"apiVersion: v1\nkind: ConfigMap\nmetadata: {name: a, namespace: app}\n",
+		"apiVersion: v1\nkind: Service\nmetadata: {name: a, namespace: app}\n",
+		"apiVersion: v1\nkind: Namespace\nmetadata: {name: app}\n",
+	} {
+		node := yaml.MustParse(text)
+		nodes[resid.FromRNode(node)] = node
+	}
+
+	fileSys := filesys.MakeFsInMemory()
+	store := &resource.FileStore{
+		FileSystem:    fileSys,
+		NameGenerator: resource.FileNameTemplate("${NAMESPACE}/${KIND}.yaml", types.PathVars{}),
+	}
+
+	if err := store.WriteAll(maps.All(nodes)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+
+	for _, path := range []string{"app/ConfigMap.yaml", "app/Service.yaml", "Namespace.yaml"} {
+		body, err := fileSys.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got[path] = string(body)
+	}
+
+	want := map[string]string{
+		"app/ConfigMap.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata: {name: a, namespace: app}\n" +
+			"---\napiVersion: v1\nkind: ConfigMap\nmetadata: {name: b, namespace: app}\n",
+		"app/Service.yaml": "apiVersion: v1\nkind: Service\nmetadata: {name: a, namespace: app}\n",
+		"Namespace.yaml":   "apiVersion: v1\nkind: Namespace\nmetadata: {name: app}\n",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("-want +got:\n%s", diff)
+	}
+}
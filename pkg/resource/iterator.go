@@ -19,6 +19,7 @@ type Iterator struct {
 	clusters []types.ClusterID
 	states   stack[*iteratorState]
 	current  *iteratorState
+	skip     bool
 	err      error
 }
 
@@ -86,23 +87,61 @@ func (it *Iterator) Values() iter.Seq2[types.ClusterID, *yaml.Node] {
 	}
 }
 
+// IsValue reports whether the current node is a value, i.e. a scalar or a
+// list without merge keys.
+func (it *Iterator) IsValue() bool {
+	return it.current.isValue
+}
+
+// Nodes returns the current nodes, including the subtrees of mappings and
+// associative lists.
+func (it *Iterator) Nodes() iter.Seq2[types.ClusterID, *yaml.Node] {
+	return func(yield func(types.ClusterID, *yaml.Node) bool) {
+		for idx := range it.clusters {
+			value := it.current.values[idx]
+			if value == nil {
+				continue
+			}
+
+			if !yield(it.clusters[idx], value) {
+				return
+			}
+		}
+	}
+}
+
+// Skip excludes the children of the current node from the iteration.
+func (it *Iterator) Skip() {
+	it.skip = true
+}
+
 func (it *Iterator) Next() bool {
+	if it.current != nil && !it.skip {
+		batch, err := it.current.unfold()
+		if err != nil {
+			it.err = err
+
+			return false
+		}
+
+		sort.Sort(iteratorStatesOrder(batch))
+		it.states.push(batch...)
+	}
+
+	it.skip = false
+
 	if len(it.states) == 0 {
 		return false
 	}
 
 	it.current = it.states.pop()
 
-	batch, err := it.current.unfold()
-	if err != nil {
+	if err := it.current.init(); err != nil {
 		it.err = err
 
 		return false
 	}
 
-	sort.Sort(iteratorStatesOrder(batch))
-	it.states.push(batch...)
-
 	return true
 }
 
@@ -104,3 +104,40 @@ spec:
 		t.Errorf("-want +got:\n%v", diff)
 	}
 }
+
+func TestIteratorSkip(t *testing.T) {
+	node := yaml.MustParse(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels:
+    app: app
+spec:
+  replicas: 1
+`)
+	idx := types.NewClusterIndex()
+	c1 := idx.Add(types.Cluster{Name: "c1"})
+	schema := openapi.SchemaForResourceType(yaml.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"})
+	it := resource.NewIterator(map[types.ClusterID]*yaml.RNode{c1: node}, schema)
+
+	got := []string{}
+
+	for it.Next() {
+		path := it.Path().String()
+		got = append(got, path)
+
+		if path == "metadata" {
+			it.Skip()
+		}
+	}
+
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"", "apiVersion", "kind", "metadata", "spec", "spec.replicas"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("-want +got:\n%v", diff)
+	}
+}
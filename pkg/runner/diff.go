@@ -0,0 +1,204 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Mirantis/ktl/pkg/kubectl"
+	"github.com/Mirantis/ktl/pkg/source"
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ClusterDiff loads a resource of the selected clusters with the source and
+// filters of the pipeline.
+type ClusterDiff struct {
+	Pipeline *Pipeline
+	// Clusters are the compared cluster names, all clusters by default.
+	Clusters []string
+	// Kind is the resource kind, the api resource name or short name,
+	// optionally qualified with the group, e.g. "deploy" or
+	// "deployments.apps". The kinds of the kustomize source are matched by
+	// their name, plural or prefix.
+	Kind string
+	Name string
+	// KeepTags loads all clusters of the source, their tags are used to
+	// name the cluster groups.
+	KeepTags bool
+}
+
+var (
+	errUnknownKind      = errors.New("unknown resource kind")
+	errResourceNotFound = errors.New("resource not found")
+)
+
+// matchAPIResource reports whether the kind names the api resource by its
+// kind, name or short name, optionally qualified with the group.
+func matchAPIResource(kind string, res kubectl.APIResource) bool {
+	name, group, _ := strings.Cut(strings.ToLower(kind), ".")
+	if group != "" && group != res.Group {
+		return false
+	}
+
+	return name == strings.ToLower(res.Kind) || name == res.Name || slices.Contains(res.ShortNames, name)
+}
+
+// matchKind reports whether the resource kind matches the kind, its plural
+// name or their prefix, the api resources are unknown to the kustomize source.
+func matchKind(kind string, id resid.ResId) bool {
+	name, group, _ := strings.Cut(strings.ToLower(kind), ".")
+	if group != "" && group != strings.ToLower(id.Group) {
+		return false
+	}
+
+	idKind := strings.ToLower(id.Kind)
+	plurals := []string{idKind + "s", idKind + "es"}
+
+	if singular, found := strings.CutSuffix(idKind, "y"); found {
+		plurals = append(plurals, singular+"ies")
+	}
+
+	return strings.HasPrefix(idKind, name) || slices.Contains(plurals, name)
+}
+
+// apiResources returns the api resources of the kind, as listed by the
+// compared clusters or the current context.
+func (cfg *ClusterDiff) apiResources(cmd *kubectl.Cmd) ([]kubectl.APIResource, error) {
+	cmds := []*kubectl.Cmd{cmd}
+	if len(cfg.Clusters) > 0 {
+		cmds = nil
+		for _, name := range cfg.Clusters {
+			cmds = append(cmds, cmd.Cluster(name))
+		}
+	}
+
+	resolved := map[string]kubectl.APIResource{}
+
+	for _, cmd := range cmds {
+		resources, err := cmd.APIResourceKinds()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get API resources list: %w", err)
+		}
+
+		for _, res := range resources {
+			if matchAPIResource(cfg.Kind, res) {
+				resolved[res.FullName()] = res
+			}
+		}
+	}
+
+	if len(resolved) == 0 {
+		return nil, fmt.Errorf("%w: %s", errUnknownKind, cfg.Kind)
+	}
+
+	names := slices.Sorted(maps.Keys(resolved))
+	apiResources := make([]kubectl.APIResource, 0, len(names))
+
+	for _, name := range names {
+		apiResources = append(apiResources, resolved[name])
+	}
+
+	return apiResources, nil
+}
+
+// narrow restricts the source to the compared clusters and resources, it
+// returns the matcher of the resource kind.
+func (cfg *ClusterDiff) narrow(env *types.Env) (func(resid.ResId) bool, error) {
+	clusters := []types.ClusterSelector{{Names: types.PatternSelector{Include: cfg.Clusters}}}
+	narrowClusters := len(cfg.Clusters) > 0 && !cfg.KeepTags
+	match := func(id resid.ResId) bool {
+		return matchKind(cfg.Kind, id)
+	}
+
+	switch src := cfg.Pipeline.Source.Impl.(type) {
+	case *source.Kubeconfig:
+		apiResources, err := cfg.apiResources(src.Cmd(env))
+		if err != nil {
+			return nil, err
+		}
+
+		if narrowClusters {
+			src.Clusters = clusters
+		}
+
+		names := types.Patterns{}
+		for _, res := range apiResources {
+			names = append(names, res.FullName())
+		}
+
+		for i := range src.Resources {
+			src.Resources[i].Names.Include = types.Patterns{cfg.Name}
+			src.Resources[i].Resources.Include = names
+		}
+
+		match = func(id resid.ResId) bool {
+			return slices.ContainsFunc(apiResources, func(res kubectl.APIResource) bool {
+				return res.Kind == id.Kind && res.Group == id.Group
+			})
+		}
+	case *source.Kustomize:
+		if narrowClusters {
+			src.Clusters = clusters
+		}
+	}
+
+	return match, nil
+}
+
+func (cfg *ClusterDiff) Run(env *types.Env) (*types.ClusterResources, error) {
+	match, err := cfg.narrow(env)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded, err := loadResources(env, cfg.Pipeline.Source, cfg.Pipeline.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := &types.ClusterResources{
+		Clusters:  types.NewClusterIndex(),
+		Resources: map[resid.ResId]map[types.ClusterID]*yaml.RNode{},
+	}
+	clusterIDs := map[types.ClusterID]types.ClusterID{}
+
+	for clusterID, cluster := range loaded.Clusters.All() {
+		if len(cfg.Clusters) == 0 || slices.Contains(cfg.Clusters, cluster.Name) {
+			clusterIDs[clusterID] = selected.Clusters.Add(cluster)
+		}
+	}
+
+	for _, name := range cfg.Clusters {
+		if _, err := selected.Clusters.ID(name); err != nil {
+			return nil, fmt.Errorf("unable to select clusters: %w", err)
+		}
+	}
+
+	for id, byCluster := range loaded.Resources {
+		if id.Name != cfg.Name || !match(id) {
+			continue
+		}
+
+		resources := map[types.ClusterID]*yaml.RNode{}
+
+		for clusterID, node := range byCluster {
+			if selectedID, found := clusterIDs[clusterID]; found {
+				resources[selectedID] = node
+			}
+		}
+
+		if len(resources) > 0 {
+			selected.Resources[id] = resources
+		}
+	}
+
+	if len(selected.Resources) == 0 {
+		return nil, fmt.Errorf("%w: %s %s", errResourceNotFound, cfg.Kind, cfg.Name)
+	}
+
+	return selected, nil
+}
@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/Mirantis/ktl/pkg/types"
+	"sigs.k8s.io/kustomize/kyaml/kio/filters"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Drift compares the live clusters with the desired state, both sources are
+// filtered with the same filters.
+type Drift struct {
+	Desired Source `yaml:"desired"`
+	Live    Source `yaml:"live"`
+
+	Filters []filters.KFilter `yaml:"filters"`
+}
+
+type drift Drift
+
+func (cfg *Drift) UnmarshalYAML(node *yaml.Node) error {
+	base := &drift{}
+	if err := node.Decode(base); err != nil {
+		return fmt.Errorf("unable to parse config: %w", err)
+	}
+
+	*cfg = Drift(*base)
+	cfg.Filters = append(cfg.Filters, defaultFilters()...)
+
+	return nil
+}
+
+func (cfg *Drift) Run(env *types.Env) (*output.DriftReport, error) {
+	desired, err := loadResources(env, cfg.Desired, cfg.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the desired state: %w", err)
+	}
+
+	live, err := loadResources(env, cfg.Live, cfg.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the live state: %w", err)
+	}
+
+	return output.Drift(desired, live), nil
+}
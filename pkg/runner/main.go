@@ -1,10 +1,12 @@
 package runner
 
 import (
+	"cmp"
 	_ "embed"
 	"errors"
 	"fmt"
 
+	"github.com/Mirantis/ktl/pkg/output"
 	"github.com/Mirantis/ktl/pkg/types"
 	"sigs.k8s.io/kustomize/kyaml/kio"
 	"sigs.k8s.io/kustomize/kyaml/kio/filters"
@@ -12,13 +14,19 @@ import (
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
-const DefaultFileName = "rekustomization.yaml"
+const (
+	DefaultFileName = "rekustomization.yaml"
+	// defaultGroupsFile stores the group names, unless groupNames.stateFile
+	// is set.
+	defaultGroupsFile = ".ktl-groups.yaml"
+)
 
 var (
 	//go:embed defaults.yaml
 	defaultsYaml []byte
 
-	errUnsupportedKind = errors.New("unsupported source")
+	errUnsupportedKind  = errors.New("unsupported source")
+	errFleetFilterOrder = errors.New("fleet filters must follow the cluster filters")
 )
 
 type Pipeline struct {
@@ -26,44 +34,91 @@ type Pipeline struct {
 	Output Output `yaml:"output"`
 
 	Filters []filters.KFilter `yaml:"filters"`
+	// GroupNames customizes the names of the components and chart presets.
+	GroupNames types.GroupNaming `yaml:"groupNames"`
+	// Verify renders the stored output back and compares it with the
+	// resources of every cluster.
+	Verify bool `yaml:"verify"`
 }
 
 type rekustomization Pipeline
 
-func (cfg *Pipeline) UnmarshalYAML(node *yaml.Node) error {
+// defaultFilters returns the filters dropping the fields populated by the
+// clusters, they are appended to the configured ones.
+func defaultFilters() []filters.KFilter {
 	defaults := &rekustomization{}
 	if err := yaml.Unmarshal(defaultsYaml, &defaults); err != nil {
 		panic(fmt.Errorf("broken defaults: %w", err))
 	}
 
+	return defaults.Filters
+}
+
+// checkFleetFilters rejects the cluster filters configured after a fleet
+// filter, the fleet filters run after the filters of every cluster.
+func checkFleetFilters(kfilters []filters.KFilter) error {
+	fleet := false
+
+	for i := range kfilters {
+		filter, ok := kfilters[i].Filter.(types.FleetFilter)
+
+		switch {
+		case ok && filter.FleetMode():
+			fleet = true
+		case fleet:
+			return fmt.Errorf("%w: filter %d", errFleetFilterOrder, i+1)
+		}
+	}
+
+	return nil
+}
+
+func (cfg *Pipeline) UnmarshalYAML(node *yaml.Node) error {
 	base := &rekustomization{}
 	if err := node.Decode(base); err != nil {
 		return fmt.Errorf("unable to parse config: %w", err)
 	}
 
+	if err := checkFleetFilters(base.Filters); err != nil {
+		return err
+	}
+
 	cfg.Source = base.Source
 	cfg.Output = base.Output
 	cfg.Filters = base.Filters
-	cfg.Filters = append(cfg.Filters, defaults.Filters...)
+	cfg.GroupNames = base.GroupNames
+	cfg.Verify = base.Verify
+	cfg.Filters = append(cfg.Filters, defaultFilters()...)
 
 	return nil
 }
 
-func (cfg *Pipeline) Run(env *types.Env) error {
+// clusterFilters returns the filters applied to the resources of the cluster.
+func clusterFilters(clusters *types.ClusterIndex, id types.ClusterID, kfilters []filters.KFilter) []kio.Filter {
 	filters := []kio.Filter{}
 
-	for i := range cfg.Filters {
-		filters = append(filters, cfg.Filters[i].Filter)
+	for i := range kfilters {
+		if filter, ok := kfilters[i].Filter.(types.ClusterFilter); ok {
+			filters = append(filters, filter.ForCluster(clusters, id))
+		} else {
+			filters = append(filters, kfilters[i].Filter)
+		}
 	}
 
-	sres, err := cfg.Source.Load(env)
+	return filters
+}
+
+// loadResources loads the source and filters the resources of every cluster.
+func loadResources(env *types.Env, src Source, kfilters []filters.KFilter) (*types.ClusterResources, error) {
+	sres, err := src.Load(env)
 	if err != nil {
-		return err //nolint:wrapcheck
+		return nil, err //nolint:wrapcheck
 	}
 
 	ridx := map[resid.ResId]map[types.ClusterID]*yaml.RNode{}
 
 	for clusterID, nodes := range sres.Resources {
+		filters := clusterFilters(sres.Clusters, clusterID, kfilters)
 		filtered := &kio.PackageBuffer{}
 		pipeline := &kio.Pipeline{
 			Inputs: []kio.Reader{
@@ -76,7 +131,7 @@ func (cfg *Pipeline) Run(env *types.Env) error {
 		}
 
 		if err := pipeline.Execute(); err != nil {
-			return err //nolint:wrapcheck
+			return nil, err //nolint:wrapcheck
 		}
 
 		for _, node := range filtered.Nodes {
@@ -97,5 +152,99 @@ func (cfg *Pipeline) Run(env *types.Env) error {
 		Resources: ridx,
 	}
 
-	return cfg.Output.Store(env, cres) //nolint:wrapcheck
+	for i := range kfilters {
+		if filter, ok := kfilters[i].Filter.(types.FleetFilter); ok && filter.FleetMode() {
+			if err := filter.FilterFleet(cres); err != nil {
+				return nil, fmt.Errorf("unable to filter the fleet: %w", err)
+			}
+		}
+	}
+
+	return cres, nil
+}
+
+func (cfg *Pipeline) Run(env *types.Env) error {
+	cres, err := loadResources(env, cfg.Source, cfg.Filters)
+	if err != nil {
+		return err
+	}
+
+	if err := cres.Clusters.SetNaming(cfg.GroupNames); err != nil {
+		return fmt.Errorf("invalid group names: %w", err)
+	}
+
+	if err := cfg.loadGroupNames(env, cres.Clusters); err != nil {
+		return err
+	}
+
+	if err := cfg.Output.Store(env, cres); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if err := cres.Clusters.NamingError(); err != nil {
+		return fmt.Errorf("unable to name the cluster groups: %w", err)
+	}
+
+	if err := cfg.storeGroupNames(env, cres.Clusters); err != nil {
+		return err
+	}
+
+	if !cfg.Verify {
+		return nil
+	}
+
+	if err := output.Verify(env, cfg.Output.Impl, cres); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+
+	return nil
+}
+
+// groupsFile returns the path of the group names state file.
+func (cfg *Pipeline) groupsFile() string {
+	return cmp.Or(cfg.GroupNames.StateFile, defaultGroupsFile)
+}
+
+// loadGroupNames loads the group names of the previous run, if any.
+func (cfg *Pipeline) loadGroupNames(env *types.Env, clusters *types.ClusterIndex) error {
+	path := cfg.groupsFile()
+	if !env.FileSys.Exists(path) {
+		return nil
+	}
+
+	body, err := env.FileSys.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read group names: %w", err)
+	}
+
+	groups := map[string][]string{}
+	if err := yaml.Unmarshal(body, &groups); err != nil {
+		return fmt.Errorf("unable to parse group names: %w", err)
+	}
+
+	clusters.SetPrevious(groups)
+
+	return nil
+}
+
+// storeGroupNames stores the group names for the next run, if any group is
+// named by the output.
+func (cfg *Pipeline) storeGroupNames(env *types.Env, clusters *types.ClusterIndex) error {
+	groups := clusters.NamedGroups()
+	if len(groups) == 0 {
+		return nil
+	}
+
+	path := cfg.groupsFile()
+
+	body, err := yaml.Marshal(groups)
+	if err != nil {
+		return fmt.Errorf("unable to store group names: %w", err)
+	}
+
+	if err := env.FileSys.WriteFile(path, body); err != nil {
+		return fmt.Errorf("unable to store group names: %w", err)
+	}
+
+	return nil
 }
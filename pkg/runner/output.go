@@ -34,6 +34,34 @@ func (out *Output) UnmarshalYAML(node *yaml.Node) error {
 		impl := &output.ChartOutput{}
 		out.Impl = impl
 
+		return node.Decode(impl) //nolint:wrapcheck
+	case "ArgoApplicationSet":
+		impl := &output.ArgoOutput{}
+		out.Impl = impl
+
+		wrapped := struct {
+			Output Output `yaml:"output"`
+		}{}
+		if err := node.Decode(&wrapped); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		impl.Output = wrapped.Output.Impl
+
+		return node.Decode(impl) //nolint:wrapcheck
+	case "Flux":
+		impl := &output.FluxOutput{}
+		out.Impl = impl
+
+		wrapped := struct {
+			Output Output `yaml:"output"`
+		}{}
+		if err := node.Decode(&wrapped); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		impl.Output = wrapped.Output.Impl
+
 		return node.Decode(impl) //nolint:wrapcheck
 	case "CSV":
 		impl := &output.CSVOutput{}
@@ -44,6 +72,11 @@ func (out *Output) UnmarshalYAML(node *yaml.Node) error {
 		impl := &output.TableOutput{}
 		out.Impl = impl
 
+		return node.Decode(impl) //nolint:wrapcheck
+	case "VarianceReport":
+		impl := &output.VarianceReportOutput{}
+		out.Impl = impl
+
 		return node.Decode(impl) //nolint:wrapcheck
 	case "MCPTool":
 		impl := &output.MCPToolOutput{}
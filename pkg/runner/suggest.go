@@ -0,0 +1,38 @@
+package runner
+
+import (
+	"github.com/Mirantis/ktl/pkg/output"
+	"github.com/Mirantis/ktl/pkg/types"
+)
+
+// TagSuggestion suggests the cluster tags for the source of the pipeline.
+type TagSuggestion struct {
+	Pipeline *Pipeline
+	MaxTags  int
+}
+
+// componentsOutput returns the components output of the pipeline, possibly
+// wrapped by the argo or flux output, or the default one.
+func componentsOutput(impl output.Impl) *output.ComponentsOutput {
+	switch out := impl.(type) {
+	case *output.ComponentsOutput:
+		return out
+	case *output.ArgoOutput:
+		return componentsOutput(out.Output)
+	case *output.FluxOutput:
+		return componentsOutput(out.Output)
+	default:
+		return &output.ComponentsOutput{}
+	}
+}
+
+func (cfg *TagSuggestion) Run(env *types.Env) ([]types.ClusterSelector, error) {
+	resources, err := loadResources(env, cfg.Pipeline.Source, cfg.Pipeline.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	out := componentsOutput(cfg.Pipeline.Output.Impl)
+
+	return output.SuggestTags(resources, out, cfg.MaxTags) //nolint:wrapcheck
+}
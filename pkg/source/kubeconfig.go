@@ -18,6 +18,8 @@ type Kubeconfig struct {
 	Path      string                   `yaml:"kubeconfig"`
 	Clusters  []types.ClusterSelector  `yaml:"clusters"`
 	Resources []types.ResourceSelector `yaml:"resources"`
+	// Metadata defines the labels collected from the clusters.
+	Metadata ClusterMetadata `yaml:"metadata"`
 }
 
 func (kcfg *Kubeconfig) UnmarshalYAML(node *yaml.Node) error {
@@ -31,22 +33,39 @@ func (kcfg *Kubeconfig) UnmarshalYAML(node *yaml.Node) error {
 	kcfg.Path = base.Path
 	kcfg.Clusters = base.Clusters
 	kcfg.Resources = defaultResources(base.Resources)
+	kcfg.Metadata = base.Metadata
 
 	return nil
 }
 
-func (kcfg *Kubeconfig) Load(env *types.Env) (*State, error) {
+// Cmd returns the kubectl command using the kubeconfig.
+func (kcfg *Kubeconfig) Cmd(env *types.Env) *kubectl.Cmd {
 	cmd := env.Cmd.SubCmd()
 	if kcfg.Path != "" {
 		cmd.Env = append(cmd.Env, "KUBECONFIG", kcfg.Path)
 	}
 
+	return cmd
+}
+
+func (kcfg *Kubeconfig) Load(env *types.Env) (*State, error) {
+	cmd := kcfg.Cmd(env)
+
 	names, err := cmd.Clusters()
 	if err != nil {
 		return nil, err //nolint:wrapcheck
 	}
 
-	clusters := types.BuildClusterIndex(names, kcfg.Clusters)
+	labels, err := kcfg.Metadata.collect(cmd, types.SelectClusters(names, kcfg.Clusters))
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := types.BuildLabeledClusterIndex(names, kcfg.Clusters, labels)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build the cluster index: %w", err)
+	}
+
 	buffers := map[types.ClusterID]*kio.PackageBuffer{}
 	errs := &errgroup.Group{}
 
@@ -87,8 +87,13 @@ func (kust *Kustomize) packages(env *types.Env) (*kustomizePkg, error) {
 		names = append(names, name)
 	}
 
+	idx, err := types.BuildClusterIndex(names, kust.Clusters)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build the cluster index: %w", err)
+	}
+
 	kpkg := &kustomizePkg{
-		idx:   types.BuildClusterIndex(names, kust.Clusters),
+		idx:   idx,
 		paths: map[types.ClusterID]string{},
 	}
 
@@ -0,0 +1,215 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+	"sync"
+
+	"github.com/Mirantis/ktl/pkg/kubectl"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	versionLabel  = "version"
+	providerLabel = "provider"
+)
+
+// ClusterMetadata defines the labels collected from the clusters, they are
+// matched by the label expressions of the cluster selectors.
+type ClusterMetadata struct {
+	// Version labels the clusters with the server minor version, e.g.
+	// "version=1.31".
+	Version bool `yaml:"version"`
+	// Provider labels the clusters with the cloud provider of the nodes,
+	// e.g. "provider=aws".
+	Provider bool `yaml:"provider"`
+	// NodeLabels map the labels to the node labels shared by all nodes, e.g.
+	// "region: topology.kubernetes.io/region".
+	NodeLabels map[string]string `yaml:"nodeLabels"`
+	// ConfigMap is the "namespace/name" of the config map holding the labels.
+	ConfigMap string `yaml:"configMap"`
+	// Namespace holds the labels of the clusters.
+	Namespace string `yaml:"namespace"`
+}
+
+var errInvalidConfigMap = errors.New(`invalid config map, want "namespace/name"`)
+
+func (meta *ClusterMetadata) UnmarshalYAML(node *yaml.Node) error {
+	type clusterMetadata ClusterMetadata
+
+	base := &clusterMetadata{}
+	if err := node.Decode(base); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if base.ConfigMap != "" {
+		namespace, name, _ := strings.Cut(base.ConfigMap, "/")
+		if namespace == "" || name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("%w: %s", errInvalidConfigMap, base.ConfigMap)
+		}
+	}
+
+	*meta = ClusterMetadata(*base)
+
+	return nil
+}
+
+func (meta *ClusterMetadata) empty() bool {
+	return !meta.Version && !meta.Provider && len(meta.NodeLabels) == 0 && meta.ConfigMap == "" && meta.Namespace == ""
+}
+
+// collect returns the labels of the clusters.
+func (meta *ClusterMetadata) collect(cmd *kubectl.Cmd, names []string) (map[string]map[string]string, error) {
+	labels := map[string]map[string]string{}
+
+	if meta.empty() {
+		return labels, nil
+	}
+
+	lock := &sync.Mutex{}
+	errs := &errgroup.Group{}
+
+	for _, name := range names {
+		errs.Go(func() error {
+			clusterLabels, err := meta.clusterLabels(cmd.Cluster(name))
+			if err != nil {
+				return fmt.Errorf("unable to collect metadata of %s: %w", name, err)
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			labels[name] = clusterLabels
+
+			return nil
+		})
+	}
+
+	if err := errs.Wait(); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return labels, nil
+}
+
+func (meta *ClusterMetadata) clusterLabels(cmd *kubectl.Cmd) (map[string]string, error) {
+	labels := map[string]string{}
+
+	if meta.Version {
+		info, err := cmd.Version()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get server version: %w", err)
+		}
+
+		if info.ServerVersion != nil {
+			minor := strings.TrimRight(info.ServerVersion.Minor, "+")
+			labels[versionLabel] = info.ServerVersion.Major + "." + minor
+		}
+	}
+
+	if meta.Provider || len(meta.NodeLabels) > 0 {
+		nodes, err := cmd.Get([]string{"nodes"}, "", nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get nodes: %w", err)
+		}
+
+		maps.Copy(labels, meta.nodeLabels(nodes))
+	}
+
+	if meta.ConfigMap != "" {
+		namespace, name, _ := strings.Cut(meta.ConfigMap, "/")
+
+		configMaps, err := cmd.Get([]string{"configmaps"}, namespace, nil, name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get config map %s: %w", meta.ConfigMap, err)
+		}
+
+		for _, configMap := range configMaps {
+			maps.Copy(labels, configMap.GetDataMap())
+		}
+	}
+
+	if meta.Namespace != "" {
+		namespaces, err := cmd.Get([]string{"namespaces"}, "", nil, meta.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get namespace %s: %w", meta.Namespace, err)
+		}
+
+		for _, namespace := range namespaces {
+			maps.Copy(labels, namespace.GetLabels())
+		}
+	}
+
+	return validLabels(labels), nil
+}
+
+// nodeLabels returns the labels shared by all nodes.
+func (meta *ClusterMetadata) nodeLabels(nodes []*yaml.RNode) map[string]string {
+	labels := map[string]string{}
+	candidates := maps.Clone(meta.NodeLabels)
+
+	if meta.Provider {
+		candidates[providerLabel] = ""
+	}
+
+	for label, nodeLabel := range candidates {
+		values := map[string]bool{}
+
+		for _, node := range nodes {
+			if label == providerLabel && nodeLabel == "" {
+				values[nodeProvider(node)] = true
+			} else {
+				values[node.GetLabels()[nodeLabel]] = true
+			}
+		}
+
+		if len(values) != 1 {
+			continue
+		}
+
+		for value := range values {
+			if value != "" {
+				labels[label] = value
+			}
+		}
+	}
+
+	return labels
+}
+
+// nodeProvider returns the provider of the node ID, e.g. "aws" for
+// "aws:///eu-west-1a/i-0123".
+func nodeProvider(node *yaml.RNode) string {
+	providerID, err := node.GetString("spec.providerID")
+	if err != nil {
+		return ""
+	}
+
+	provider, _, _ := strings.Cut(providerID, "://")
+
+	return provider
+}
+
+// validLabels drops the labels unusable in the label selectors.
+func validLabels(labels map[string]string) map[string]string {
+	for key, value := range labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			slog.Warn("skipping invalid cluster label", "key", key, "errors", errs)
+			delete(labels, key)
+
+			continue
+		}
+
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			slog.Warn("skipping invalid cluster label", "key", key, "value", value, "errors", errs)
+			delete(labels, key)
+		}
+	}
+
+	return labels
+}
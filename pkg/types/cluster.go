@@ -35,6 +35,11 @@ type ClusterIndex struct {
 	byName map[string]ClusterID
 
 	cachedGroups map[string]string
+	naming       GroupNaming
+	aliases      map[string]string
+	previous     map[string]string
+	named        map[string][]string
+	namingErrs   []error
 	cachedTags   []string
 	cachedTagsCB []*roaring.Bitmap
 }
@@ -43,35 +48,99 @@ func NewClusterIndex() *ClusterIndex {
 	return &ClusterIndex{
 		byName:       map[string]ClusterID{},
 		cachedGroups: map[string]string{},
+		named:        map[string][]string{},
 	}
 }
 
-func BuildClusterIndex(names []string, groups []ClusterSelector) *ClusterIndex {
+func BuildClusterIndex(names []string, groups []ClusterSelector) (*ClusterIndex, error) {
+	return BuildLabeledClusterIndex(names, groups, nil)
+}
+
+// SelectClusters returns the names selected by the selectors without label
+// expressions.
+func SelectClusters(names []string, groups []ClusterSelector) []string {
+	selected := sets.String{}
+
+	for _, group := range groups {
+		if group.Selector.IsZero() {
+			selected.Insert(group.Names.Select(names)...)
+		}
+	}
+
+	return slices.Sorted(maps.Keys(selected))
+}
+
+// BuildLabeledClusterIndex builds the index of the clusters with the labels
+// collected from the clusters, e.g. their versions. The collected labels are
+// matched by the label expressions of the selectors. The clusters assigned
+// different values of the same label are rejected.
+//
+//nolint:lll
+func BuildLabeledClusterIndex(names []string, groups []ClusterSelector, labels map[string]map[string]string) (*ClusterIndex, error) {
 	index := NewClusterIndex()
 	clusterTags := map[string]sets.String{}
 
+	assign := func(name string, group ClusterSelector) {
+		tags, exists := clusterTags[name]
+		if !exists {
+			tags = sets.String{}
+			clusterTags[name] = tags
+		}
+
+		tags.Insert(group.Tags...)
+
+		for key, value := range group.Labels {
+			tags.Insert(labelTag(key, value))
+		}
+	}
+
 	for _, group := range groups {
+		if !group.Selector.IsZero() {
+			continue
+		}
+
 		for _, name := range group.Names.Select(names) {
-			tags, exists := clusterTags[name]
-			if !exists {
-				tags = sets.String{}
-				clusterTags[name] = tags
-			}
+			assign(name, group)
+		}
+	}
+
+	for name, tags := range clusterTags {
+		for key, value := range labels[name] {
+			tags.Insert(labelTag(key, value))
+		}
 
-			tags.Insert(group.Tags...)
+		if err := checkLabels(name, slices.Sorted(maps.Keys(tags))); err != nil {
+			return nil, err
+		}
+	}
+
+	// the expressions match the labels assigned so far, only the selected
+	// clusters are labeled
+	for _, group := range groups {
+		if group.Selector.IsZero() {
+			continue
+		}
+
+		for _, name := range group.Names.Select(slices.Sorted(maps.Keys(clusterTags))) {
+			cluster := Cluster{Name: name, Tags: clusterTags[name].List()}
+			if group.Selector.Matches(cluster) {
+				assign(name, group)
+			}
 		}
 	}
 
 	sortedNames := slices.Sorted(maps.Keys(clusterTags))
 
 	for _, name := range sortedNames {
-		index.Add(Cluster{
-			Name: name,
-			Tags: slices.Sorted(maps.Keys(clusterTags[name])),
-		})
+		tags := slices.Sorted(maps.Keys(clusterTags[name]))
+		if err := checkLabels(name, tags); err != nil {
+			return nil, err
+		}
+
+		index.Add(Cluster{Name: name, Tags: tags})
 	}
 
-	return index
+	return index, nil
 }
 
 func (idx *ClusterIndex) All() iter.Seq2[ClusterID, Cluster] {
@@ -118,8 +187,12 @@ func (idx *ClusterIndex) Add(cluster Cluster) ClusterID {
 
 	if len(idx.cachedGroups) > 0 {
 		idx.cachedGroups = map[string]string{}
+		idx.named = map[string][]string{}
+		idx.namingErrs = nil
 	}
 
+	idx.aliases = nil
+
 	idx.cachedTags = nil
 	idx.cachedTagsCB = nil
 
@@ -201,6 +274,21 @@ func (idx *ClusterIndex) tags() iter.Seq2[string, *roaring.Bitmap] {
 	}
 }
 
+func (idx *ClusterIndex) Tags() iter.Seq2[string, []ClusterID] {
+	return func(yield func(string, []ClusterID) bool) {
+		for tag, tagCB := range idx.tags() {
+			ids := []ClusterID{}
+			for it := tagCB.Iterator(); it.HasNext(); {
+				ids = append(ids, ClusterID(it.Next()))
+			}
+
+			if !yield(tag, ids) {
+				return
+			}
+		}
+	}
+}
+
 func (idx *ClusterIndex) Group(ids ...ClusterID) string {
 	if len(ids) == 0 {
 		return ""
@@ -222,41 +310,182 @@ func (idx *ClusterIndex) Group(ids ...ClusterID) string {
 		bitmap.Add(uint32(id))
 	}
 
+	group := idx.groupName(bitmap)
+	idx.cachedGroups[key] = group
+	idx.recordName(bitmap, group)
+
+	return group
+}
+
+// groupName returns the alias of the clusters, or the shortest name built of
+// their tags and names, or of the tags and names of the other clusters, e.g.
+// "all-except-prod-b".
+func (idx *ClusterIndex) groupName(bitmap *roaring.Bitmap) string {
 	if len(idx.items) == int(bitmap.GetCardinality()) { //nolint
-		return "all-clusters"
+		return allClustersName
 	}
 
-	remaining := bitmap.Clone()
-	parts := []string{}
+	if alias, found := idx.alias(bitmap); found {
+		return alias
+	}
 
-	for tag, tagCB := range idx.tags() {
-		if tagCB.GetCardinality() != tagCB.AndCardinality(bitmap) {
-			continue
+	parts, names := idx.cover(bitmap)
+	name := strings.Join(append(parts, names...), "_")
+
+	if len(names) > 0 {
+		complement := roaring.Flip(bitmap, 0, uint64(len(idx.items)))
+		complementParts, complementNames := idx.cover(complement)
+
+		if len(complementParts)+len(complementNames) < len(parts)+len(names) {
+			name = allExceptPrefix + strings.Join(append(complementParts, complementNames...), "_")
 		}
+	}
 
-		if !tagCB.Intersects(remaining) {
-			continue
+	return idx.capLength(bitmap, name)
+}
+
+// cover returns the names of the labels selecting exactly the clusters, or
+// the minimal set of the tags and the names of the remaining clusters.
+func (idx *ClusterIndex) cover(bitmap *roaring.Bitmap) ([]string, []string) {
+	if labels := idx.labelGroup(bitmap); len(labels) > 0 {
+		return labels, nil
+	}
+
+	candidates := []string{}
+	candidatesCB := []*roaring.Bitmap{}
+
+	for tag, tagCB := range idx.tags() {
+		if tagCB.GetCardinality() == tagCB.AndCardinality(bitmap) {
+			candidates = append(candidates, tag)
+			candidatesCB = append(candidatesCB, tagCB)
 		}
+	}
 
-		remaining.AndNot(tagCB)
+	var selected []int
+	if len(candidates) > maxCoverCandidates {
+		selected = greedyCover(bitmap, candidatesCB)
+	} else {
+		selected = minimalCover(bitmap, candidatesCB)
+	}
 
-		parts = append(parts, tag)
+	parts := []string{}
+	remaining := bitmap.Clone()
+
+	for _, candidate := range selected {
+		parts = append(parts, tagName(candidates[candidate]))
+		remaining.AndNot(candidatesCB[candidate])
 	}
 
 	names := []string{}
 
 	for it := remaining.Iterator(); it.HasNext(); {
-		id := it.Next()
-		names = append(names, idx.items[id].Name)
+		names = append(names, idx.items[it.Next()].Name)
 	}
 
 	slices.Sort(names)
-	parts = append(parts, names...)
 
-	group := strings.Join(parts, "_")
-	idx.cachedGroups[key] = group
+	return parts, names
+}
 
-	return group
+// maxCoverCandidates limits the exhaustive search of the minimal cover.
+const maxCoverCandidates = 16
+
+// greedyCover selects the candidates by size, while they add clusters.
+func greedyCover(bitmap *roaring.Bitmap, candidates []*roaring.Bitmap) []int {
+	remaining := bitmap.Clone()
+	selected := []int{}
+
+	for idx, candidate := range candidates {
+		if candidate.Intersects(remaining) {
+			remaining.AndNot(candidate)
+			selected = append(selected, idx)
+		}
+	}
+
+	return selected
+}
+
+// minimalCover selects the candidates minimizing the number of the selected
+// candidates and the remaining clusters, the fewer remaining clusters and the
+// larger candidates are preferred.
+func minimalCover(bitmap *roaring.Bitmap, candidates []*roaring.Bitmap) []int {
+	best := greedyCover(bitmap, candidates)
+	bestParts, bestRemaining := coverSize(bitmap, candidates, best)
+	selected := []int{}
+
+	var search func(next int, remaining *roaring.Bitmap)
+	search = func(next int, remaining *roaring.Bitmap) {
+		size := int(remaining.GetCardinality())
+		if parts := len(selected) + size; parts < bestParts || (parts == bestParts && size < bestRemaining) {
+			best, bestParts, bestRemaining = slices.Clone(selected), parts, size
+		}
+
+		if size == 0 || len(selected)+1 > bestParts {
+			return
+		}
+
+		for idx := next; idx < len(candidates); idx++ {
+			if !candidates[idx].Intersects(remaining) {
+				continue
+			}
+
+			selected = append(selected, idx)
+			search(idx+1, roaring.AndNot(remaining, candidates[idx]))
+			selected = selected[:len(selected)-1]
+		}
+	}
+
+	search(0, bitmap.Clone())
+
+	return best
+}
+
+func coverSize(bitmap *roaring.Bitmap, candidates []*roaring.Bitmap, selected []int) (int, int) {
+	remaining := bitmap.Clone()
+	for _, idx := range selected {
+		remaining.AndNot(candidates[idx])
+	}
+
+	size := int(remaining.GetCardinality())
+
+	return len(selected) + size, size
+}
+
+// labelGroup returns the names of the labels selecting exactly the clusters,
+// e.g. "env-prod" and "region-eu", or nil.
+func (idx *ClusterIndex) labelGroup(bitmap *roaring.Bitmap) []string {
+	if len(idx.cachedTags) == 0 {
+		idx.rebuildTags()
+	}
+
+	labels := []string{}
+	intersection := (*roaring.Bitmap)(nil)
+
+	// the smallest labels first, they narrow the intersection the most
+	for i := len(idx.cachedTags) - 1; i >= 0; i-- {
+		tag, tagCB := idx.cachedTags[i], idx.cachedTagsCB[i]
+		if !strings.Contains(tag, "=") || tagCB.AndCardinality(bitmap) != bitmap.GetCardinality() {
+			continue
+		}
+
+		if intersection == nil {
+			intersection = tagCB.Clone()
+		} else if intersection.AndCardinality(tagCB) < intersection.GetCardinality() {
+			intersection.And(tagCB)
+		} else {
+			continue
+		}
+
+		labels = append(labels, tagName(tag))
+
+		if intersection.Equals(bitmap) {
+			slices.Sort(labels)
+
+			return labels
+		}
+	}
+
+	return nil
 }
 
 type orderTagsBySizeAndName struct {
@@ -274,9 +503,9 @@ func (o *orderTagsBySizeAndName) Swap(a, b int) {
 }
 
 func (o *orderTagsBySizeAndName) Less(a, b int) bool { //nolint:varnamelen
-	delta := o.bitmaps[a].GetCardinality() - o.bitmaps[b].GetCardinality()
-	if delta != 0 {
-		return delta > 0
+	sizeA, sizeB := o.bitmaps[a].GetCardinality(), o.bitmaps[b].GetCardinality()
+	if sizeA != sizeB {
+		return sizeA > sizeB
 	}
 
 	return strings.Compare(o.tags[a], o.tags[b]) < 0
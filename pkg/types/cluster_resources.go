@@ -2,6 +2,9 @@ package types
 
 import (
 	"iter"
+	"maps"
+	"slices"
+	"strings"
 
 	"sigs.k8s.io/kustomize/kyaml/resid"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
@@ -23,3 +26,26 @@ func (res *ClusterResources) All() iter.Seq2[resid.ResId, *yaml.RNode] {
 		}
 	}
 }
+
+func (res *ClusterResources) Cluster(cluster ClusterID) iter.Seq2[resid.ResId, *yaml.RNode] {
+	return func(yield func(resid.ResId, *yaml.RNode) bool) {
+		for id, byCluster := range res.Resources {
+			rnode, found := byCluster[cluster]
+			if !found {
+				continue
+			}
+
+			if !yield(id, rnode) {
+				return
+			}
+		}
+	}
+}
+
+// IDs returns the resource IDs in a stable order, the outputs depending on
+// the order of the resources add them in this order.
+func (res *ClusterResources) IDs() []resid.ResId {
+	return slices.SortedFunc(maps.Keys(res.Resources), func(a, b resid.ResId) int {
+		return strings.Compare(a.String(), b.String())
+	})
+}
@@ -1,9 +1,12 @@
 package types_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
 func TestClusterIndexGroup(t *testing.T) {
@@ -39,7 +42,7 @@ func TestClusterIndexGroup(t *testing.T) {
 			ids:  []types.ClusterID{c1, c4},
 		},
 		{
-			want: "c2_c3_c4_c5",
+			want: "all-except-c1",
 			ids:  []types.ClusterID{c2, c3, c4, c5},
 		},
 		{
@@ -59,3 +62,191 @@ func TestClusterIndexGroup(t *testing.T) {
 		})
 	}
 }
+
+func TestClusterIndexLabelGroup(t *testing.T) {
+	idx := types.NewClusterIndex()
+	c1 := idx.Add(types.Cluster{Name: "c1", Tags: []string{"env=prod", "region=eu"}}) //nolint:varnamelen
+	c2 := idx.Add(types.Cluster{Name: "c2", Tags: []string{"env=prod", "region=eu"}}) //nolint:varnamelen
+	c3 := idx.Add(types.Cluster{Name: "c3", Tags: []string{"env=prod", "region=us"}}) //nolint:varnamelen
+	c4 := idx.Add(types.Cluster{Name: "c4", Tags: []string{"env=dev", "region=eu"}})  //nolint:varnamelen
+
+	tests := []struct {
+		want string
+		ids  []types.ClusterID
+	}{
+		{
+			want: "env-prod_region-eu",
+			ids:  []types.ClusterID{c1, c2},
+		},
+		{
+			want: "env-prod",
+			ids:  []types.ClusterID{c1, c2, c3},
+		},
+		{
+			want: "region-eu",
+			ids:  []types.ClusterID{c1, c2, c4},
+		},
+		{
+			want: "env-dev_region-us",
+			ids:  []types.ClusterID{c3, c4},
+		},
+		{
+			want: "region-us_c1",
+			ids:  []types.ClusterID{c1, c3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			got := idx.Group(test.ids...)
+			if got == test.want {
+				return
+			}
+
+			t.Errorf("got: %s, want: %s", got, test.want)
+		})
+	}
+}
+
+func TestBuildClusterIndexLabels(t *testing.T) {
+	groups := []types.ClusterSelector{}
+	config := `
+- names: [prod-*]
+  labels: {env: prod}
+- names: [stage-*]
+  labels: {env: stage}
+- names: [prod-eu, stage-eu]
+  tags: [region=eu]
+- names: [dev-*]
+  tags: [dev]
+- selector: env in (prod,stage),region=eu
+  tags: [gdpr]
+`
+
+	if err := yaml.Unmarshal([]byte(config), &groups); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := types.BuildClusterIndex([]string{"dev-eu", "prod-eu", "prod-us", "stage-eu", "test"}, groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string][]string{}
+
+	for _, cluster := range idx.All() {
+		got[cluster.Name] = cluster.Tags
+	}
+
+	want := map[string][]string{
+		"dev-eu":   {"dev"},
+		"prod-eu":  {"env=prod", "gdpr", "region=eu"},
+		"prod-us":  {"env=prod"},
+		"stage-eu": {"env=stage", "gdpr", "region=eu"},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestBuildClusterIndexConflictingLabels(t *testing.T) {
+	tests := map[string]string{
+		"names": `
+- names: [prod-*]
+  labels: {env: prod}
+- names: [prod-eu]
+  tags: [env=stage]
+`,
+		"selector": `
+- names: [prod-*]
+  labels: {env: prod}
+- selector: env=prod
+  labels: {env: stage}
+`,
+	}
+
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			groups := []types.ClusterSelector{}
+			if err := yaml.Unmarshal([]byte(config), &groups); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := types.BuildClusterIndex([]string{"prod-eu", "prod-us"}, groups)
+			if err == nil || !strings.Contains(err.Error(), "conflicting label values") {
+				t.Errorf("want conflicting labels error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLabelSelectorUnmarshal(t *testing.T) {
+	var selector types.LabelSelector
+	if err := yaml.Unmarshal([]byte(`env in (prod`), &selector); err == nil {
+		t.Error("expected an error")
+	}
+
+	groups := []types.ClusterSelector{}
+	if err := yaml.Unmarshal([]byte("- selector: env in (prod)\n- tags: [dev]\n"), &groups); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := yaml.Marshal(groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "- names: []\n  selector: env in (prod)\n- names: []\n  tags:\n  - dev\n"
+	if diff := cmp.Diff(want, string(body)); diff != "" {
+		t.Errorf("marshaled selectors mismatch, +got -want:\n%s", diff)
+	}
+}
+
+func TestBuildLabeledClusterIndex(t *testing.T) {
+	groups := []types.ClusterSelector{
+		{Names: types.PatternSelector{Include: []string{"prod-*"}}, Tags: types.StrList{"prod"}},
+		{Selector: mustParseSelector(t, "version=1.31"), Tags: types.StrList{"upgrade"}},
+	}
+	labels := map[string]map[string]string{
+		"prod-a": {"version": "1.31"},
+		"prod-b": {"version": "1.32"},
+		"test-a": {"version": "1.31"},
+	}
+
+	names := []string{"prod-a", "prod-b", "test-a"}
+	if diff := cmp.Diff([]string{"prod-a", "prod-b"}, types.SelectClusters(names, groups)); diff != "" {
+		t.Error(diff)
+	}
+
+	idx, err := types.BuildLabeledClusterIndex(names, groups, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string][]string{}
+
+	for _, cluster := range idx.All() {
+		got[cluster.Name] = cluster.Tags
+	}
+
+	want := map[string][]string{
+		"prod-a": {"prod", "upgrade", "version=1.31"},
+		"prod-b": {"prod", "version=1.32"},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func mustParseSelector(t *testing.T, expr string) types.LabelSelector {
+	t.Helper()
+
+	selector, err := types.ParseLabelSelector(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return selector
+}
@@ -2,7 +2,12 @@ package types
 
 type ClusterSelector struct {
 	Names PatternSelector `yaml:"names"`
-	Tags  StrList         `yaml:"tags"`
+	// Selector narrows the clusters by the labels assigned by the selectors
+	// without expressions, e.g. "env in (prod,stage),region=eu".
+	Selector LabelSelector `yaml:"selector,omitempty"`
+	// Labels are added as "key=value" tags, e.g. "env=prod".
+	Labels map[string]string `yaml:"labels,omitempty"`
+	Tags   StrList           `yaml:"tags,omitempty"`
 }
 
 type ResourceSelector struct {
@@ -0,0 +1,138 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// LabelSelector is a label selector expression matching the cluster labels,
+// e.g. "env in (prod,stage),region=eu". The plain tags are the labels without
+// values, they are matched by the existence expressions, e.g. "prod".
+type LabelSelector struct {
+	expr     string
+	selector labels.Selector
+}
+
+// ParseLabelSelector parses the label selector expression.
+func ParseLabelSelector(expr string) (LabelSelector, error) {
+	selector, err := labels.Parse(expr)
+	if err != nil {
+		return LabelSelector{}, fmt.Errorf("invalid label selector: %w", err)
+	}
+
+	return LabelSelector{expr: expr, selector: selector}, nil
+}
+
+func (sel *LabelSelector) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid label selector: %w", err)
+	}
+
+	selector, err := ParseLabelSelector(raw)
+	if err != nil {
+		return err
+	}
+
+	*sel = selector
+
+	return nil
+}
+
+func (sel LabelSelector) MarshalYAML() (any, error) {
+	return sel.expr, nil
+}
+
+// IsZero reports whether the expression is empty, the empty selectors are
+// omitted.
+func (sel LabelSelector) IsZero() bool {
+	return sel.expr == ""
+}
+
+// Equal reports whether the expressions are the same.
+func (sel LabelSelector) Equal(other LabelSelector) bool {
+	return sel.expr == other.expr
+}
+
+func (sel LabelSelector) String() string {
+	return sel.expr
+}
+
+// Matches reports whether the cluster labels match the expression, the empty
+// expression matches all clusters.
+func (sel LabelSelector) Matches(cluster Cluster) bool {
+	if sel.selector == nil {
+		return true
+	}
+
+	return sel.selector.Matches(cluster.Labels())
+}
+
+var errConflictingLabels = errors.New("conflicting label values")
+
+// checkLabels returns an error if the tags assign different values to the
+// same label, e.g. "env=prod" and "env=stage".
+func checkLabels(name string, tags []string) error {
+	values := map[string]string{}
+
+	for _, tag := range tags {
+		key, value, _ := strings.Cut(tag, "=")
+		if previous, found := values[key]; found && previous != value {
+			return fmt.Errorf("%w: cluster %s, label %s: %q and %q", errConflictingLabels, name, key, previous, value)
+		}
+
+		values[key] = value
+	}
+
+	return nil
+}
+
+// Labels returns the cluster tags as labels, e.g. "env=prod" is the "env"
+// label, "prod" is the "prod" label without a value. The cluster index
+// rejects the clusters assigning different values to the same label.
+func (cluster Cluster) Labels() labels.Set {
+	set := labels.Set{}
+
+	for _, tag := range cluster.Tags {
+		key, value, _ := strings.Cut(tag, "=")
+		set[key] = value
+	}
+
+	return set
+}
+
+// labelTag returns the tag of the label.
+func labelTag(key, value string) string {
+	if value == "" {
+		return key
+	}
+
+	return key + "=" + value
+}
+
+// tagName returns the tag as a part of the group names, e.g. "env-prod" for
+// "env=prod".
+func tagName(tag string) string {
+	return strings.Replace(tag, "=", "-", 1)
+}
+
+// ClusterFilter is implemented by the filters depending on the cluster, e.g.
+// targeting the clusters with a label selector.
+type ClusterFilter interface {
+	// ForCluster returns the filter applied to the resources of the cluster.
+	ForCluster(clusters *ClusterIndex, id ClusterID) kio.Filter
+}
+
+// FleetFilter is implemented by the filters processing the resources of all
+// clusters at once, they are applied after the filters of every cluster.
+type FleetFilter interface {
+	// FleetMode reports whether the filter processes all clusters at once,
+	// instead of the resources of every cluster.
+	FleetMode() bool
+	FilterFleet(resources *ClusterResources) error
+}
@@ -0,0 +1,172 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+// groupHashLength is the number of the hex digits of the group name hash.
+const groupHashLength = 8
+
+const (
+	allClustersName = "all-clusters"
+	allExceptPrefix = "all-except-"
+)
+
+var errNameCollision = errors.New("same name for different cluster groups")
+
+// GroupNaming customizes the names of the cluster groups, e.g. components
+// and chart presets.
+type GroupNaming struct {
+	// Aliases name the groups of exactly the selected clusters, e.g.
+	// "canary" for "prod-a,stage-a".
+	Aliases map[string]PatternSelector `yaml:"aliases"`
+	// MaxLength caps the group names, the longer names are truncated and
+	// suffixed with a hash of the cluster names.
+	MaxLength int `yaml:"maxLength"`
+	// StateFile stores the names of the groups, the groups renamed since the
+	// previous run are reported, ".ktl-groups.yaml" by default.
+	StateFile string `yaml:"stateFile"`
+}
+
+// SetNaming sets the naming of the groups. The aliases must differ from the
+// tags, the cluster names and the generated names, e.g. "all-clusters".
+func (idx *ClusterIndex) SetNaming(naming GroupNaming) error {
+	reserved := map[string]string{allClustersName: "the group of all clusters"}
+
+	for _, cluster := range idx.items {
+		reserved[cluster.Name] = "a cluster name"
+
+		for _, tag := range cluster.Tags {
+			reserved[tagName(tag)] = "a tag name"
+		}
+	}
+
+	for _, alias := range slices.Sorted(maps.Keys(naming.Aliases)) {
+		if what, found := reserved[alias]; found {
+			return fmt.Errorf("%w: alias %s is %s", errNameCollision, alias, what)
+		}
+
+		if strings.HasPrefix(alias, allExceptPrefix) {
+			return fmt.Errorf("%w: alias %s starts with %s", errNameCollision, alias, allExceptPrefix)
+		}
+	}
+
+	idx.naming = naming
+	idx.aliases = nil
+	idx.cachedGroups = map[string]string{}
+	idx.named = map[string][]string{}
+	idx.namingErrs = nil
+
+	return nil
+}
+
+// NamingError returns the error of the names shared by different groups of
+// clusters, e.g. a tag named after a cluster of another group.
+func (idx *ClusterIndex) NamingError() error {
+	return errors.Join(idx.namingErrs...)
+}
+
+// SetPrevious sets the groups named by the previous run, as returned by
+// NamedGroups. The renamed groups are reported.
+func (idx *ClusterIndex) SetPrevious(groups map[string][]string) {
+	idx.previous = map[string]string{}
+
+	for name, clusters := range groups {
+		idx.previous[namesKey(clusters)] = name
+	}
+}
+
+// NamedGroups returns the cluster names of the named groups.
+func (idx *ClusterIndex) NamedGroups() map[string][]string {
+	return maps.Clone(idx.named)
+}
+
+func namesKey(names []string) string {
+	return strings.Join(slices.Sorted(slices.Values(names)), ",")
+}
+
+func bitmapKey(bitmap *roaring.Bitmap) string {
+	return fmt.Sprint(bitmap.ToArray())
+}
+
+func (idx *ClusterIndex) bitmapNames(bitmap *roaring.Bitmap) []string {
+	names := []string{}
+	for it := bitmap.Iterator(); it.HasNext(); {
+		names = append(names, idx.items[it.Next()].Name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// alias returns the alias of exactly the clusters, if any.
+func (idx *ClusterIndex) alias(bitmap *roaring.Bitmap) (string, bool) {
+	if idx.aliases == nil {
+		idx.aliases = map[string]string{}
+		allNames := slices.Collect(idx.Names(idx.ids...))
+
+		for _, alias := range slices.Sorted(maps.Keys(idx.naming.Aliases)) {
+			selector := idx.naming.Aliases[alias]
+			aliasCB := roaring.NewBitmap()
+
+			for _, name := range selector.Select(allNames) {
+				aliasCB.Add(uint32(idx.byName[name]))
+			}
+
+			if key := bitmapKey(aliasCB); idx.aliases[key] == "" {
+				idx.aliases[key] = alias
+			}
+		}
+	}
+
+	alias, found := idx.aliases[bitmapKey(bitmap)]
+
+	return alias, found
+}
+
+// capLength truncates the long names, the hash of the cluster names keeps
+// them unique and stable.
+func (idx *ClusterIndex) capLength(bitmap *roaring.Bitmap, name string) string {
+	maxLength := idx.naming.MaxLength
+	if maxLength <= 0 || len(name) <= maxLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(namesKey(idx.bitmapNames(bitmap))))
+	hash := hex.EncodeToString(sum[:])[:groupHashLength]
+	prefix := strings.TrimRight(name[:max(0, maxLength-groupHashLength-1)], "-_")
+
+	if prefix == "" {
+		return hash
+	}
+
+	return prefix + "-" + hash
+}
+
+// recordName records the name of the group, the group named differently by
+// the previous run is reported.
+func (idx *ClusterIndex) recordName(bitmap *roaring.Bitmap, name string) {
+	names := idx.bitmapNames(bitmap)
+	if other, found := idx.named[name]; found && !slices.Equal(other, names) {
+		idx.namingErrs = append(idx.namingErrs, fmt.Errorf(
+			"%w: %s for %s and %s", errNameCollision, name, namesKey(other), namesKey(names),
+		))
+	}
+
+	idx.named[name] = names
+
+	previous, found := idx.previous[namesKey(names)]
+	if found && previous != name {
+		slog.Warn("cluster group renamed", "from", previous, "to", name)
+	}
+}
@@ -0,0 +1,110 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClusterIndexGroupNaming(t *testing.T) {
+	idx := types.NewClusterIndex()
+	devA := idx.Add(types.Cluster{Name: "dev-a", Tags: []string{"dev"}})
+	prodA := idx.Add(types.Cluster{Name: "prod-a", Tags: []string{"prod"}})
+	prodB := idx.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod"}})
+	testA := idx.Add(types.Cluster{Name: "test-a", Tags: []string{"test"}})
+	testB := idx.Add(types.Cluster{Name: "test-b", Tags: []string{"test"}})
+
+	err := idx.SetNaming(types.GroupNaming{
+		Aliases: map[string]types.PatternSelector{
+			"canary": {Include: []string{"dev-a", "prod-a"}},
+		},
+		MaxLength: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		want string
+		ids  []types.ClusterID
+	}{
+		{
+			want: "canary",
+			ids:  []types.ClusterID{devA, prodA},
+		},
+		{
+			want: "prod_dev",
+			ids:  []types.ClusterID{devA, prodA, prodB},
+		},
+		{
+			want: "test_prod-a",
+			ids:  []types.ClusterID{prodA, testA, testB},
+		},
+		{
+			want: "all-exc-e9438342",
+			ids:  []types.ClusterID{devA, prodA, testA, testB},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			got := idx.Group(test.ids...)
+			if got == test.want {
+				return
+			}
+
+			t.Errorf("got: %s, want: %s", got, test.want)
+		})
+	}
+
+	want := map[string][]string{
+		"canary":           {"dev-a", "prod-a"},
+		"prod_dev":         {"dev-a", "prod-a", "prod-b"},
+		"test_prod-a":      {"prod-a", "test-a", "test-b"},
+		"all-exc-e9438342": {"dev-a", "prod-a", "test-a", "test-b"},
+	}
+
+	if diff := cmp.Diff(want, idx.NamedGroups()); diff != "" {
+		t.Error(diff)
+	}
+
+	if err := idx.NamingError(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClusterIndexGroupNameCollisions(t *testing.T) {
+	idx := types.NewClusterIndex()
+	prodA := idx.Add(types.Cluster{Name: "prod-a"})
+	prodB := idx.Add(types.Cluster{Name: "prod-b", Tags: []string{"prod-a"}})
+	prodC := idx.Add(types.Cluster{Name: "prod-c", Tags: []string{"prod-a"}})
+
+	for _, alias := range []string{"prod-a", "prod-b", "all-clusters", "all-except-prod-a"} {
+		err := idx.SetNaming(types.GroupNaming{
+			Aliases: map[string]types.PatternSelector{alias: {Include: []string{"prod-b"}}},
+		})
+		if err == nil {
+			t.Errorf("want an error for alias %s", alias)
+		}
+	}
+
+	if err := idx.SetNaming(types.GroupNaming{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := idx.Group(prodB, prodC); got != "prod-a" {
+		t.Fatalf("got: %s, want: prod-a", got)
+	}
+
+	if err := idx.NamingError(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cluster is named like the tag of the other clusters
+	idx.Group(prodA)
+
+	if err := idx.NamingError(); err == nil {
+		t.Error("want a name collision error")
+	}
+}
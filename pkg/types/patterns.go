@@ -5,8 +5,10 @@ import (
 	"encoding/csv"
 	"fmt"
 	"path"
+	"regexp"
 	"slices"
 	"strings"
+	"sync"
 
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
@@ -59,6 +61,15 @@ func (l *StrList) unmarshalScalar(node *yaml.Node) error {
 	return nil
 }
 
+// regexpPrefix marks the patterns holding regular expressions, e.g.
+// "re:prod-(eu|us)-\d+".
+const regexpPrefix = "re:"
+
+// compiledPatterns caches the regular expressions of the patterns.
+var compiledPatterns sync.Map //nolint:gochecknoglobals
+
+// Patterns are shell-like patterns, "**" matches across "/" as well. The
+// patterns prefixed with "re:" are regular expressions matching whole names.
 type Patterns StrList //nolint:recvcheck
 
 func (p *Patterns) UnmarshalYAML(node *yaml.Node) error {
@@ -68,7 +79,7 @@ func (p *Patterns) UnmarshalYAML(node *yaml.Node) error {
 	}
 
 	for _, pattern := range parts {
-		if _, err := path.Match(pattern, ""); err != nil {
+		if _, err := matchPattern(pattern, ""); err != nil {
 			return fmt.Errorf("invalid pattern: %w", err)
 		}
 	}
@@ -80,7 +91,7 @@ func (p *Patterns) UnmarshalYAML(node *yaml.Node) error {
 
 func (p Patterns) Match(name string) bool {
 	for _, pattern := range p {
-		match, err := path.Match(pattern, name)
+		match, err := matchPattern(pattern, name)
 		if err != nil {
 			panic(err)
 		}
@@ -93,6 +104,154 @@ func (p Patterns) Match(name string) bool {
 	return false
 }
 
+func matchPattern(pattern, name string) (bool, error) {
+	expr, isRegexp := strings.CutPrefix(pattern, regexpPrefix)
+
+	switch {
+	case isRegexp:
+	case strings.Contains(pattern, "**"):
+		var err error
+		if expr, err = globRegexp(pattern); err != nil {
+			return false, err
+		}
+	default:
+		return path.Match(pattern, name) //nolint:wrapcheck
+	}
+
+	compiled, err := compilePattern(expr)
+	if err != nil {
+		return false, err
+	}
+
+	return compiled.MatchString(name), nil
+}
+
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if compiled, found := compiledPatterns.Load(expr); found {
+		return compiled.(*regexp.Regexp), nil //nolint:forcetypeassert
+	}
+
+	compiled, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	compiledPatterns.Store(expr, compiled)
+
+	return compiled, nil
+}
+
+// globRegexp converts the shell-like pattern to a regular expression, "**"
+// matches any sequence, "*" and "?" do not match "/".
+func globRegexp(pattern string) (string, error) {
+	runes := []rune(pattern)
+	expr := &strings.Builder{}
+
+	for idx := 0; idx < len(runes); idx++ {
+		switch char := runes[idx]; char {
+		case '*':
+			if idx+1 < len(runes) && runes[idx+1] == '*' {
+				expr.WriteString(".*")
+				idx++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '\\':
+			idx++
+			if idx == len(runes) {
+				return "", path.ErrBadPattern
+			}
+
+			expr.WriteString(regexp.QuoteMeta(string(runes[idx])))
+		case '[':
+			class, end, err := globClass(runes, idx+1)
+			if err != nil {
+				return "", err
+			}
+
+			expr.WriteString(class)
+			idx = end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+
+	return expr.String(), nil
+}
+
+// globClass converts the character class starting after "[", it returns the
+// index of the closing "]". The class is parsed the way path.Match does: it is
+// not empty, the "-" and "]" characters of the ranges are escaped, e.g.
+// "[\]a]".
+func globClass(runes []rune, start int) (string, int, error) {
+	class := &strings.Builder{}
+	class.WriteString("[")
+
+	idx := start
+	if idx < len(runes) && runes[idx] == '^' {
+		class.WriteString("^")
+		idx++
+	}
+
+	for ranges := 0; ; ranges++ {
+		if idx < len(runes) && runes[idx] == ']' && ranges > 0 {
+			class.WriteString("]")
+
+			return class.String(), idx, nil
+		}
+
+		low, next, err := globClassChar(runes, idx)
+		if err != nil {
+			return "", 0, err
+		}
+
+		class.WriteString(classChar(low))
+		idx = next
+
+		if idx < len(runes) && runes[idx] == '-' {
+			high, next, err := globClassChar(runes, idx+1)
+			if err != nil {
+				return "", 0, err
+			}
+
+			if high < low {
+				return "", 0, path.ErrBadPattern
+			}
+
+			class.WriteString("-" + classChar(high))
+			idx = next
+		}
+	}
+}
+
+// globClassChar returns the possibly escaped character of the class range
+// and the index after it.
+func globClassChar(runes []rune, idx int) (rune, int, error) {
+	if idx >= len(runes) || runes[idx] == '-' || runes[idx] == ']' {
+		return 0, 0, path.ErrBadPattern
+	}
+
+	if runes[idx] == '\\' {
+		idx++
+		if idx >= len(runes) {
+			return 0, 0, path.ErrBadPattern
+		}
+	}
+
+	return runes[idx], idx + 1, nil
+}
+
+// classChar escapes the characters special in the regular expression classes.
+func classChar(char rune) string {
+	if strings.ContainsRune(`\]^-[`, char) {
+		return `\` + string(char)
+	}
+
+	return string(char)
+}
+
 type PatternSelector struct {
 	Include Patterns `json:"include" yaml:"include"`
 	Exclude Patterns `json:"exclude" yaml:"exclude"`
@@ -128,6 +287,17 @@ func (sel *PatternSelector) Select(names []string) []string {
 	return result
 }
 
+// MarshalYAML returns the patterns as a list, the excluded ones are prefixed
+// with "-".
+func (sel PatternSelector) MarshalYAML() (any, error) {
+	patterns := slices.Clone([]string(sel.Include))
+	for _, pattern := range sel.Exclude {
+		patterns = append(patterns, "-"+pattern)
+	}
+
+	return patterns, nil
+}
+
 func (sel *PatternSelector) UnmarshalYAML(node *yaml.Node) error {
 	if node == nil {
 		*sel = PatternSelector{}
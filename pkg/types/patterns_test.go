@@ -36,6 +36,31 @@ func TestPatternsUnmarshal(t *testing.T) {
 			input:   `[ "[a" ]`,
 			wantErr: true,
 		},
+		{
+			name:  `regexp`,
+			input: `[ 're:prod-(eu|us)-\d+', "apps/**" ]`,
+			want:  types.Patterns{`re:prod-(eu|us)-\d+`, "apps/**"},
+		},
+		{
+			name:    `regexp-syntax-error`,
+			input:   `[ "re:prod-(eu" ]`,
+			wantErr: true,
+		},
+		{
+			name:    `doublestar-syntax-error`,
+			input:   `[ "**[a" ]`,
+			wantErr: true,
+		},
+		{
+			name:    `doublestar-leading-bracket`,
+			input:   `[ "**[]a]" ]`,
+			wantErr: true,
+		},
+		{
+			name:  `doublestar-escaped-bracket`,
+			input: `[ '**[\]a]' ]`,
+			want:  types.Patterns{`**[\]a]`},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -137,6 +162,7 @@ func TestPatternSelector(t *testing.T) {
 	tests := []struct {
 		name     string
 		selector types.PatternSelector
+		names    []string
 		want     []string
 		wantErr  string
 	}{
@@ -153,14 +179,76 @@ func TestPatternSelector(t *testing.T) {
 				Exclude: types.Patterns{"*x", "*y*"},
 			},
 		},
+		{
+			name: "regexp",
+			want: []string{"abc123", "def123"},
+			selector: types.PatternSelector{
+				Include: types.Patterns{`re:(abc|def)\d+`},
+			},
+		},
+		{
+			name:  "doublestar",
+			names: []string{"deployments.apps/v1", "deployments.apps/v1/scale", "deployments.apps/v1beta1", "pods/v1"},
+			want:  []string{"deployments.apps/v1", "deployments.apps/v1/scale"},
+			selector: types.PatternSelector{
+				Include: types.Patterns{"deployments.**"},
+				Exclude: types.Patterns{"*/v1beta?"},
+			},
+		},
+		{
+			name:  "doublestar non-ascii",
+			names: []string{"café/menü", "café/x/ü", "cafe/menu", "cafés/ü"},
+			want:  []string{"café/menü", "café/x/ü"},
+			selector: types.PatternSelector{
+				Include: types.Patterns{"caf?/**ü"},
+			},
+		},
+		{
+			name:  "doublestar escaped bracket",
+			names: []string{"a/]", "a/b/a", "a/b"},
+			want:  []string{"a/]", "a/b/a"},
+			selector: types.PatternSelector{
+				Include: types.Patterns{`**[\]a]`},
+			},
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got := test.selector.Select(input)
+			names := input
+			if test.names != nil {
+				names = test.names
+			}
+
+			got := test.selector.Select(names)
 			if diff := cmp.Diff(test.want, got); diff != "" {
 				t.Errorf("unexpected result, +got -want:\n%v", diff)
 			}
 		})
 	}
 }
+
+func TestPatternSelectorMarshal(t *testing.T) {
+	selector := types.PatternSelector{
+		Include: types.Patterns{"a", "d"},
+		Exclude: types.Patterns{"b", "c"},
+	}
+
+	body, err := yaml.Marshal(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff("- a\n- d\n- -b\n- -c\n", string(body)); diff != "" {
+		t.Errorf("-want +got:\n%s", diff)
+	}
+
+	var got types.PatternSelector
+	if err := yaml.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(selector, got); diff != "" {
+		t.Errorf("round trip mismatch, -want +got:\n%s", diff)
+	}
+}
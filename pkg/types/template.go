@@ -0,0 +1,158 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+var (
+	errTemplateVariable = errors.New("unknown path template variable")
+	errTemplateAbsPath  = errors.New("absolute path template not allowed")
+	errTemplateEscape   = errors.New("path template outside of the output directory not allowed")
+
+	templateVarRegexp = regexp.MustCompile(`\$\{([A-Z_]+)(?::([^}]*))?\}`)
+)
+
+// PathTemplate is a file or directory path with ${VARIABLE} placeholders:
+//
+//   - ${CLUSTER}: cluster name
+//   - ${TAGS}: all cluster tags, joined with "_"
+//   - ${TAG}: the first cluster tag, ${TAG:pattern} - the first tag matching
+//     the shell-like pattern
+//   - ${LABEL:key}: value of the cluster label, e.g. "prod" for "env=prod"
+//   - ${GROUP}: name of the cluster group, e.g. component
+//   - ${CHART}: chart name
+//   - ${NAMESPACE}, ${NAME}, ${KIND}, ${API_GROUP}, ${VERSION}: resource ID
+//
+// Empty path elements are dropped, e.g. cluster-scoped resources have no
+// ${NAMESPACE} directory.
+type PathTemplate string
+
+type PathVars struct {
+	Cluster *Cluster
+	Group   string
+	Chart   string
+	ResID   *resid.ResId
+}
+
+func (tmpl *PathTemplate) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid path template: %w", err)
+	}
+
+	if filepath.IsAbs(raw) {
+		return fmt.Errorf("%w: %s", errTemplateAbsPath, raw)
+	}
+
+	if slices.Contains(strings.Split(filepath.ToSlash(raw), "/"), "..") {
+		return fmt.Errorf("%w: %s", errTemplateEscape, raw)
+	}
+
+	for _, match := range templateVarRegexp.FindAllStringSubmatch(raw, -1) {
+		if err := checkTemplateVar(match[1], match[2]); err != nil {
+			return err
+		}
+	}
+
+	*tmpl = PathTemplate(raw)
+
+	return nil
+}
+
+func checkTemplateVar(name, arg string) error {
+	switch name {
+	case "TAG":
+		if _, err := path.Match(arg, ""); err != nil {
+			return fmt.Errorf("invalid path template pattern: %w", err)
+		}
+
+		return nil
+	case "LABEL":
+		if arg == "" {
+			return fmt.Errorf("%w: %s", errTemplateVariable, name)
+		}
+
+		return nil
+	case "CLUSTER", "TAGS", "GROUP", "CHART", "NAMESPACE", "NAME", "KIND", "API_GROUP", "VERSION":
+		if arg != "" {
+			return fmt.Errorf("%w: %s:%s", errTemplateVariable, name, arg)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", errTemplateVariable, name)
+	}
+}
+
+func (tmpl PathTemplate) Expand(vars PathVars) string {
+	expanded := templateVarRegexp.ReplaceAllStringFunc(string(tmpl), func(match string) string {
+		parts := templateVarRegexp.FindStringSubmatch(match)
+
+		return vars.value(parts[1], parts[2])
+	})
+
+	return filepath.Join(strings.Split(expanded, "/")...)
+}
+
+//nolint:cyclop
+func (vars PathVars) value(name, arg string) string {
+	switch name {
+	case "GROUP":
+		return vars.Group
+	case "CHART":
+		return vars.Chart
+	}
+
+	if vars.Cluster != nil {
+		switch name {
+		case "CLUSTER":
+			return vars.Cluster.Name
+		case "TAGS":
+			return strings.Join(vars.Cluster.Tags, "_")
+		case "TAG":
+			return vars.Cluster.tag(arg)
+		case "LABEL":
+			return vars.Cluster.Labels()[arg]
+		}
+	}
+
+	if vars.ResID != nil {
+		switch name {
+		case "NAMESPACE":
+			return vars.ResID.Namespace
+		case "NAME":
+			return vars.ResID.Name
+		case "KIND":
+			return vars.ResID.Kind
+		case "API_GROUP":
+			return vars.ResID.Group
+		case "VERSION":
+			return vars.ResID.Version
+		}
+	}
+
+	return ""
+}
+
+func (cluster *Cluster) tag(pattern string) string {
+	for _, tag := range cluster.Tags {
+		if pattern == "" {
+			return tag
+		}
+
+		if match, _ := path.Match(pattern, tag); match {
+			return tag
+		}
+	}
+
+	return ""
+}
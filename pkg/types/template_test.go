@@ -0,0 +1,143 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/Mirantis/ktl/pkg/types"
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestPathTemplateUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    types.PathTemplate
+		wantErr bool
+	}{
+		{
+			name:  `plain`,
+			input: `overlays`,
+			want:  "overlays",
+		},
+		{
+			name:  `variables`,
+			input: `clusters/${TAG:env-*}/${CLUSTER}`,
+			want:  "clusters/${TAG:env-*}/${CLUSTER}",
+		},
+		{
+			name:    `unknown-variable`,
+			input:   `clusters/${REGION}`,
+			wantErr: true,
+		},
+		{
+			name:    `unexpected-argument`,
+			input:   `clusters/${CLUSTER:x}`,
+			wantErr: true,
+		},
+		{
+			name:    `invalid-pattern`,
+			input:   `clusters/${TAG:[a}`,
+			wantErr: true,
+		},
+		{
+			name:    `absolute`,
+			input:   `/clusters`,
+			wantErr: true,
+		},
+		{
+			name:    `parent`,
+			input:   `../clusters/${CLUSTER}`,
+			wantErr: true,
+		},
+		{
+			name:    `nested-parent`,
+			input:   `clusters/../../${CLUSTER}`,
+			wantErr: true,
+		},
+		{
+			name:  `dots`,
+			input: `clusters/..${CLUSTER}`,
+			want:  "clusters/..${CLUSTER}",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got types.PathTemplate
+
+			err := yaml.Unmarshal([]byte(test.input), &got)
+			if test.wantErr && err == nil {
+				t.Fatalf("want err, got none")
+			}
+
+			if !test.wantErr && err != nil {
+				t.Fatalf("want no err, got: %v", err)
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("-want +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPathTemplateExpand(t *testing.T) {
+	cluster := &types.Cluster{Name: "prod-a", Tags: []string{"env-prod", "region-eu"}}
+	namespaced := &resid.ResId{
+		Gvk:       resid.Gvk{Group: "apps", Version: "v1", Kind: "Deployment"},
+		Name:      "myapp",
+		Namespace: "myapp",
+	}
+	clusterScoped := &resid.ResId{
+		Gvk:  resid.Gvk{Version: "v1", Kind: "Namespace"},
+		Name: "myapp",
+	}
+
+	tests := []struct {
+		tmpl types.PathTemplate
+		vars types.PathVars
+		want string
+	}{
+		{
+			tmpl: "clusters/${TAG:env-*}/${CLUSTER}",
+			vars: types.PathVars{Cluster: cluster},
+			want: "clusters/env-prod/prod-a",
+		},
+		{
+			tmpl: "clusters/${TAG:region-*}/${TAG:zone-*}/${CLUSTER}",
+			vars: types.PathVars{Cluster: cluster},
+			want: "clusters/region-eu/prod-a",
+		},
+		{
+			tmpl: "${TAGS}/${TAG}",
+			vars: types.PathVars{Cluster: cluster},
+			want: "env-prod_region-eu/env-prod",
+		},
+		{
+			tmpl: "components/${GROUP}",
+			vars: types.PathVars{Group: "prod_test"},
+			want: "components/prod_test",
+		},
+		{
+			tmpl: "${NAMESPACE}/${API_GROUP}.${VERSION}.${KIND}.yaml",
+			vars: types.PathVars{ResID: namespaced},
+			want: "myapp/apps.v1.Deployment.yaml",
+		},
+		{
+			tmpl: "${NAMESPACE}/${KIND}.yaml",
+			vars: types.PathVars{ResID: clusterScoped},
+			want: "Namespace.yaml",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.tmpl), func(t *testing.T) {
+			got := test.tmpl.Expand(test.vars)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("-want +got:\n%s", diff)
+			}
+		})
+	}
+}